@@ -0,0 +1,144 @@
+// Package analytics derives values such as moving averages and growth rates from aggregated time series.
+//
+// Every function expects at most one data point per date, as returned by store.Service.GetAggTimeSeries,
+// and leaves a value nil when the data points it needs are not part of the series.
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jaaanko/covid-19-api/internal/store"
+)
+
+// Alignments of the window used by Smooth.
+const (
+	Trailing = "trailing"
+	Centered = "centered"
+)
+
+// Values accepted by Derive.
+const (
+	Growth       = "growth"
+	Doubling     = "doubling"
+	CaseFatality = "cfr"
+)
+
+// Smooth sets NewAvg of each data point to the average of New over window consecutive dates,
+// ending on that date for Trailing and around it for Centered.
+func Smooth(ts *store.TimeSeries, window int, alignment string) {
+	points := byDate(ts)
+
+	before := window - 1
+	if alignment == Centered {
+		before = window / 2
+	}
+
+	for i, dataPoint := range points {
+		first := i - before
+		last := first + window - 1
+		if first < 0 || last >= len(points) {
+			continue
+		}
+
+		var sum int64
+		for _, p := range points[first : last+1] {
+			sum += p.New
+		}
+
+		avg := float64(sum) / float64(window)
+		dataPoint.NewAvg = &avg
+	}
+}
+
+// GrowthRate sets GrowthRate of each data point to its daily increase relative to the amount
+// of the previous date. The increase is NewAvg when the series was smoothed and New otherwise.
+func GrowthRate(ts *store.TimeSeries) {
+	points := byDate(ts)
+
+	for i, dataPoint := range points {
+		dataPoint.GrowthRate = growth(points, i)
+	}
+}
+
+// DoublingTime sets DoublingTime of each data point to the number of days the amount would
+// take to double at the growth rate of that date. It stays nil while the amount is not growing.
+func DoublingTime(ts *store.TimeSeries) {
+	points := byDate(ts)
+
+	for i, dataPoint := range points {
+		rate := growth(points, i)
+		if rate == nil || *rate <= 0 {
+			continue
+		}
+
+		days := math.Ln2 / math.Log1p(*rate)
+		dataPoint.DoublingTime = &days
+	}
+}
+
+// CaseFatalityRatio sets CaseFatalityRatio of each data point to the deaths divided by the
+// confirmed cases on the same date.
+func CaseFatalityRatio(ts *store.TimeSeries, confirmed *store.TimeSeries, deaths *store.TimeSeries) {
+	confirmedByDate := amounts(confirmed)
+	deathsByDate := amounts(deaths)
+
+	for i := range ts.DataPoints {
+		dataPoint := &ts.DataPoints[i]
+
+		c, ok := confirmedByDate[dateKey(dataPoint.Date)]
+		if !ok || c == 0 {
+			continue
+		}
+
+		d, ok := deathsByDate[dateKey(dataPoint.Date)]
+		if !ok {
+			continue
+		}
+
+		ratio := float64(d) / float64(c)
+		dataPoint.CaseFatalityRatio = &ratio
+	}
+}
+
+func growth(points []*store.TimeSeriesDataPoint, i int) *float64 {
+	if i == 0 || points[i-1].Amount == 0 {
+		return nil
+	}
+
+	increase := float64(points[i].New)
+	if points[i].NewAvg != nil {
+		increase = *points[i].NewAvg
+	}
+
+	rate := increase / float64(points[i-1].Amount)
+	return &rate
+}
+
+// byDate returns pointers to the data points of ts from the oldest to the newest date,
+// whatever order ts is in.
+func byDate(ts *store.TimeSeries) []*store.TimeSeriesDataPoint {
+	points := make([]*store.TimeSeriesDataPoint, len(ts.DataPoints))
+	for i := range ts.DataPoints {
+		points[i] = &ts.DataPoints[i]
+	}
+
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Date.Before(points[j].Date) })
+	return points
+}
+
+// amounts returns the amounts of ts by dateKey.
+func amounts(ts *store.TimeSeries) map[string]int64 {
+	byDate := make(map[string]int64, len(ts.DataPoints))
+	for _, dataPoint := range ts.DataPoints {
+		byDate[dateKey(dataPoint.Date)] = dataPoint.Amount
+	}
+	return byDate
+}
+
+// dateKey identifies the date of t in maps, since times of the same date may differ in location or
+// monotonic reading and then compare unequal as keys.
+func dateKey(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
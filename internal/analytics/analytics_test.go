@@ -0,0 +1,127 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jaaanko/covid-19-api/internal/store"
+)
+
+// newSeries returns a series with one data point per day from 2020-03-01 with the given amounts, newest first.
+func newSeries(status string, amounts ...int64) *store.TimeSeries {
+	ts := new(store.TimeSeries)
+
+	var previous int64
+	for i, amount := range amounts {
+		ts.DataPoints = append([]store.TimeSeriesDataPoint{{
+			Amount: amount,
+			New:    amount - previous,
+			Status: status,
+			Date:   time.Date(2020, 3, 1+i, 0, 0, 0, 0, time.UTC),
+		}}, ts.DataPoints...)
+		previous = amount
+	}
+
+	return ts
+}
+
+func values(ts *store.TimeSeries, field func(store.TimeSeriesDataPoint) *float64) []*float64 {
+	got := make([]*float64, len(ts.DataPoints))
+	for i, dataPoint := range ts.DataPoints {
+		got[len(got)-1-i] = field(dataPoint)
+	}
+	return got
+}
+
+func checkValues(t *testing.T, name string, got []*float64, want []float64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("len(%s) = %d; want %d", name, len(got), len(want))
+	}
+
+	for i := range want {
+		switch {
+		case math.IsNaN(want[i]):
+			if got[i] != nil {
+				t.Errorf("%s[%d] = %v; want nil", name, i, *got[i])
+			}
+		case got[i] == nil:
+			t.Errorf("%s[%d] = nil; want %v", name, i, want[i])
+		case math.Abs(*got[i]-want[i]) > 1e-9:
+			t.Errorf("%s[%d] = %v; want %v", name, i, *got[i], want[i])
+		}
+	}
+}
+
+func TestSmooth(t *testing.T) {
+	nan := math.NaN()
+	newAvg := func(dataPoint store.TimeSeriesDataPoint) *float64 { return dataPoint.NewAvg }
+
+	// New: 1, 2, 3, 4, 5
+	ts := newSeries(store.Confirmed, 1, 3, 6, 10, 15)
+	Smooth(ts, 3, Trailing)
+	checkValues(t, "trailing NewAvg", values(ts, newAvg), []float64{nan, nan, 2, 3, 4})
+
+	ts = newSeries(store.Confirmed, 1, 3, 6, 10, 15)
+	Smooth(ts, 3, Centered)
+	checkValues(t, "centered NewAvg", values(ts, newAvg), []float64{nan, 2, 3, 4, nan})
+}
+
+func TestGrowthAndDoublingTime(t *testing.T) {
+	nan := math.NaN()
+
+	ts := newSeries(store.Confirmed, 0, 10, 20, 20, 40)
+	GrowthRate(ts)
+	DoublingTime(ts)
+
+	checkValues(t, "GrowthRate", values(ts, func(dataPoint store.TimeSeriesDataPoint) *float64 {
+		return dataPoint.GrowthRate
+	}), []float64{nan, nan, 1, 0, 1})
+
+	checkValues(t, "DoublingTime", values(ts, func(dataPoint store.TimeSeriesDataPoint) *float64 {
+		return dataPoint.DoublingTime
+	}), []float64{nan, nan, 1, nan, 1})
+}
+
+func TestGrowthRateUsesSmoothedNew(t *testing.T) {
+	ts := newSeries(store.Confirmed, 10, 20, 20)
+	Smooth(ts, 2, Trailing)
+	GrowthRate(ts)
+
+	if got := ts.DataPoints[0].GrowthRate; got == nil || *got != 0.25 {
+		t.Errorf("GrowthRate = %v; want 0.25", got)
+	}
+}
+
+func TestCaseFatalityRatio(t *testing.T) {
+	nan := math.NaN()
+
+	confirmed := newSeries(store.Confirmed, 0, 10, 40)
+	deaths := newSeries(store.Deaths, 0, 1, 2)
+
+	CaseFatalityRatio(deaths, confirmed, deaths)
+
+	checkValues(t, "CaseFatalityRatio", values(deaths, func(dataPoint store.TimeSeriesDataPoint) *float64 {
+		return dataPoint.CaseFatalityRatio
+	}), []float64{nan, 0.1, 0.05})
+}
+
+func TestCaseFatalityRatioAcrossLocations(t *testing.T) {
+	nan := math.NaN()
+
+	confirmed := newSeries(store.Confirmed, 0, 10, 40)
+	deaths := newSeries(store.Deaths, 0, 1, 2)
+
+	// The same dates, read in another location.
+	for i := range deaths.DataPoints {
+		deaths.DataPoints[i].Date = deaths.DataPoints[i].Date.In(time.FixedZone("UTC+2", 2*60*60))
+	}
+
+	CaseFatalityRatio(deaths, confirmed, deaths)
+
+	checkValues(t, "CaseFatalityRatio", values(deaths, func(dataPoint store.TimeSeriesDataPoint) *float64 {
+		return dataPoint.CaseFatalityRatio
+	}), []float64{nan, 0.1, 0.05})
+}
@@ -0,0 +1,162 @@
+// Package events is an in-process publish/subscribe bus. It keeps the latest events so that a
+// subscriber that reconnects can catch up on the ones it missed.
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Types of Event.
+const (
+	// IngestCompleted is published after a collector update succeeded, with its *store.IngestReport.
+	IngestCompleted = "ingest-completed"
+	// SummaryUpdated is published once the summaries include the data of an update.
+	SummaryUpdated = "summary-updated"
+)
+
+// subscriberBuffer is the number of events a subscriber can lag behind before it is dropped.
+const subscriberBuffer = 16
+
+type Event struct {
+	// ID increases with every event published on a Bus, starting at 1.
+	ID   uint64
+	Type string
+	Data interface{}
+	Time time.Time
+}
+
+type Bus struct {
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event
+	size        int
+	subscribers map[chan Event]bool
+	closed      bool
+}
+
+// NewBus returns a Bus that keeps the last size events for subscribers that catch up.
+func NewBus(size int) *Bus {
+	return &Bus{size: size, subscribers: make(map[chan Event]bool)}
+}
+
+// Publish sends an event to every subscriber. A subscriber whose buffer is full is dropped by
+// closing its channel, and can subscribe again from the last event it received.
+func (b *Bus) Publish(eventType string, data interface{}) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event := Event{ID: b.lastID, Type: eventType, Data: data, Time: time.Now().UTC()}
+
+	if b.closed {
+		return event
+	}
+
+	b.history = append(b.history, event)
+	if len(b.history) > b.size {
+		b.history = b.history[len(b.history)-b.size:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return event
+}
+
+// Subscribe returns a channel receiving the events published from now on, preceded by the kept
+// events published after lastID when it is not 0. The channel is closed by cancel, by Close, or
+// when the subscriber falls behind.
+func (b *Bus) Subscribe(lastID uint64) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastID == 0 {
+		lastID = b.lastID
+	}
+	ch := b.subscribe(lastID)
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if b.subscribers[ch] {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return ch, cancel
+}
+
+// subscribe returns a channel receiving the kept events published after lastID and the ones
+// published from now on. b.mu must be held.
+func (b *Bus) subscribe(lastID uint64) chan Event {
+	var missed []Event
+	for _, event := range b.history {
+		if event.ID > lastID {
+			missed = append(missed, event)
+		}
+	}
+
+	ch := make(chan Event, subscriberBuffer+len(missed))
+	for _, event := range missed {
+		ch <- event
+	}
+
+	if b.closed {
+		close(ch)
+		return ch
+	}
+
+	b.subscribers[ch] = true
+	return ch
+}
+
+// Listen calls handle with every event published from now on, in order, from a goroutine of its
+// own until the bus is closed. When handle falls behind and is dropped, it subscribes again from
+// the last event handled, so that only the events no longer kept are missed.
+func (b *Bus) Listen(handle func(event Event)) {
+	b.mu.Lock()
+	lastID := b.lastID
+	ch := b.subscribe(lastID)
+	b.mu.Unlock()
+
+	go func() {
+		for {
+			for event := range ch {
+				lastID = event.ID
+				handle(event)
+			}
+
+			b.mu.Lock()
+			if b.closed {
+				b.mu.Unlock()
+				return
+			}
+
+			log.Printf("event listener fell behind, subscribing again after event %d\n", lastID)
+			ch = b.subscribe(lastID)
+			b.mu.Unlock()
+		}
+	}()
+}
+
+// Close closes the channel of every subscriber. Events published afterwards are dropped.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,113 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusPublish(t *testing.T) {
+	bus := NewBus(10)
+
+	ch, cancel := bus.Subscribe(0)
+	defer cancel()
+
+	bus.Publish(SummaryUpdated, "first")
+
+	event := <-ch
+	if event.ID != 1 || event.Type != SummaryUpdated || event.Data != "first" {
+		t.Errorf("received %+v; want event 1 of type %s with data first", event, SummaryUpdated)
+	}
+
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Errorf("channel still open after cancel")
+	}
+}
+
+func TestBusSubscribeFromLastID(t *testing.T) {
+	bus := NewBus(2)
+
+	for _, data := range []string{"first", "second", "third"} {
+		bus.Publish(SummaryUpdated, data)
+	}
+
+	ch, cancel := bus.Subscribe(1)
+	defer cancel()
+
+	// The first event is missed, but only the last two are kept.
+	for _, want := range []uint64{2, 3} {
+		if event := <-ch; event.ID != want {
+			t.Errorf("received event %d; want %d", event.ID, want)
+		}
+	}
+}
+
+func TestBusDropsSlowSubscribers(t *testing.T) {
+	bus := NewBus(1)
+
+	ch, cancel := bus.Subscribe(0)
+	defer cancel()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		bus.Publish(SummaryUpdated, i)
+	}
+
+	received := 0
+	for range ch {
+		received++
+	}
+
+	if received != subscriberBuffer {
+		t.Errorf("received %d events before being dropped; want %d", received, subscriberBuffer)
+	}
+}
+
+func TestBusClose(t *testing.T) {
+	bus := NewBus(1)
+
+	ch, _ := bus.Subscribe(0)
+	bus.Close()
+
+	if _, ok := <-ch; ok {
+		t.Errorf("channel still open after Close")
+	}
+
+	bus.Publish(SummaryUpdated, "dropped")
+
+	ch, _ = bus.Subscribe(0)
+	if _, ok := <-ch; ok {
+		t.Errorf("channel of a closed bus is open")
+	}
+}
+
+func TestBusListenSubscribesAgain(t *testing.T) {
+	bus := NewBus(100)
+
+	release := make(chan struct{})
+	received := make(chan uint64, 100)
+
+	bus.Listen(func(event Event) {
+		<-release
+		received <- event.ID
+	})
+
+	// The listener is dropped while it waits on the first event.
+	const published = 2 * subscriberBuffer
+	for i := 0; i < published; i++ {
+		bus.Publish(SummaryUpdated, i)
+	}
+	close(release)
+
+	for want := uint64(1); want <= published; want++ {
+		select {
+		case id := <-received:
+			if id != want {
+				t.Fatalf("received event %d; want %d", id, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %d was not received", want)
+		}
+	}
+
+	bus.Close()
+}
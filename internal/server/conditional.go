@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// cacheMaxAge is how long clients and CDNs may reuse a response before revalidating it.
+const cacheMaxAge = 5 * time.Minute
+
+// ConditionalMiddleware tags successful responses with the time of the latest successful ingest,
+// since the data only changes with one. Successful responses to requests whose If-None-Match or
+// If-Modified-Since show that the client already has them are sent as 304 Not Modified. Errors are
+// neither tagged nor cached, so that they are not served again once the request would succeed.
+func (s *Server) ConditionalMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastIngest, err := s.store.GetLastIngest()
+		if err != nil {
+			log.Println("could not get the latest ingest:", err)
+		}
+
+		// The handler rejects an invalid format itself.
+		format, formatErr := responseFormat(r)
+
+		if err != nil || formatErr != nil || lastIngest.IsZero() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		lastModified := lastIngest.UTC().Truncate(time.Second)
+		etag := fmt.Sprintf(`"%x-%s"`, lastIngest.UnixNano(), format)
+
+		w.Header().Add("Vary", "Accept")
+
+		next.ServeHTTP(&validatingWriter{
+			ResponseWriter: w,
+			etag:           etag,
+			lastModified:   lastModified,
+			notModified:    notModified(r, etag, lastModified),
+		}, r)
+	})
+}
+
+// validatingWriter adds the validators and caching headers to a response once its status code
+// shows that it succeeded, and sends it as 304 Not Modified without a body if notModified is set.
+type validatingWriter struct {
+	http.ResponseWriter
+	etag         string
+	lastModified time.Time
+	notModified  bool
+
+	wroteHeader bool
+	discard     bool
+}
+
+func (w *validatingWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if statusCode < 200 || statusCode > 299 {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+
+	header := w.Header()
+	header.Set("ETag", w.etag)
+	header.Set("Last-Modified", w.lastModified.Format(http.TimeFormat))
+	header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(cacheMaxAge.Seconds())))
+
+	if w.notModified {
+		w.discard = true
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		w.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *validatingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.discard {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// notModified reports whether the conditional headers of r match etag or lastModified.
+// If-Modified-Since is ignored when If-None-Match is set.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, tag := range strings.Split(ifNoneMatch, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		return !lastModified.After(since)
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jaaanko/covid-19-api/internal/events"
+	"github.com/jaaanko/covid-19-api/internal/store"
+)
+
+// heartbeatInterval is how often a comment is sent on an idle event stream, so that proxies
+// do not close it.
+const heartbeatInterval = 15 * time.Second
+
+// reconnectDelay is how long clients wait before reconnecting to a closed event stream.
+const reconnectDelay = 5 * time.Second
+
+// summarySeries are the series whose updates change the summaries.
+var summarySeries = map[string]bool{
+	store.ConfirmedAndDeathsRun: true,
+	store.RecoveriesRun:         true,
+	store.DailyReportsRun:       true,
+}
+
+// SummaryUpdate is the data of a summary-updated event.
+type SummaryUpdate struct {
+	AsOf      time.Time `json:"asOf"`
+	Series    string    `json:"series"`
+	Countries []string  `json:"countries"`
+}
+
+// Listen makes the server publish a summary-updated event on bus for every ingest-completed event
+// of an update that changed the summaries, and stream these events on /events. It keeps listening
+// when the bus drops it for falling behind.
+func (s *Server) Listen(bus *events.Bus) {
+	s.bus = bus
+
+	bus.Listen(func(event events.Event) {
+		if event.Type != events.IngestCompleted {
+			return
+		}
+
+		report, ok := event.Data.(*store.IngestReport)
+		if !ok || !summarySeries[report.Series] || len(report.Countries) == 0 {
+			return
+		}
+
+		globalStats, err := s.store.GetGlobalStats(time.Time{})
+		if err != nil {
+			log.Println("could not publish summary update:", err)
+			return
+		}
+
+		bus.Publish(events.SummaryUpdated, &SummaryUpdate{
+			AsOf:      globalStats.AsOf,
+			Series:    report.Series,
+			Countries: report.Countries,
+		})
+	})
+}
+
+// StreamEvents streams the summary-updated events as server-sent events. A client reconnecting
+// with the Last-Event-ID header first receives the events it missed, as long as they are kept.
+func (s *Server) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	if s.bus == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("Events are not available"))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("Streaming is not supported"))
+		return
+	}
+
+	var lastID uint64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("Invalid Last-Event-ID. Please use the id of an event"))
+			return
+		}
+		lastID = id
+	}
+
+	ch, cancel := s.bus.Subscribe(lastID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", reconnectDelay.Milliseconds())
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-ch:
+			// The subscription is closed when the client falls behind, which then reconnects
+			// from the last event it received.
+			if !ok {
+				return
+			}
+
+			if event.Type != events.SummaryUpdated {
+				continue
+			}
+
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w io.Writer, event events.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
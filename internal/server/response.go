@@ -0,0 +1,310 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jaaanko/covid-19-api/internal/store"
+)
+
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// writeResponse encodes data in the format negotiated with the client: CSV when
+// ?format=csv is set or the Accept header prefers text/csv, JSON otherwise.
+func writeResponse(w http.ResponseWriter, r *http.Request, data interface{}) {
+	format, err := responseFormat(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if format == formatCSV {
+		writeCSVResponse(w, data)
+	} else {
+		writeJSONResponse(w, data)
+	}
+}
+
+func responseFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if format != formatJSON && format != formatCSV {
+			return "", errors.New("Invalid format. Please select from the following: json, csv")
+		}
+		return format, nil
+	}
+
+	format, best := formatJSON, 0.0
+	jsonQuality := -1.0
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			quality = q
+		}
+
+		switch mediaType {
+		case "text/csv":
+			if quality > best {
+				best = quality
+			}
+		case "application/json":
+			if quality > jsonQuality {
+				jsonQuality = quality
+			}
+		}
+	}
+
+	if best > 0 && best > jsonQuality {
+		format = formatCSV
+	}
+	return format, nil
+}
+
+func writeJSONResponse(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func writeCSVResponse(w http.ResponseWriter, data interface{}) {
+	header, records, err := csvRecords(data)
+	if err != nil {
+		writeError(w, http.StatusNotAcceptable, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+	writer.WriteAll(records)
+
+	if err := writer.Error(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// csvRecords flattens data into CSV rows. A Comparison is written by comparisonRecords. A slice becomes one row per element and a struct
+// becomes one row per element of its only slice of structs (such as the countries of a
+// Summary or the data points of a TimeSeries), or a single row if it has none.
+// Columns are named after the JSON fields and embedded structs are inlined.
+func csvRecords(data interface{}) ([]string, [][]string, error) {
+	if comparison, ok := data.(*store.Comparison); ok {
+		header, records := comparisonRecords(comparison)
+		return header, records, nil
+	}
+
+	v := indirect(reflect.ValueOf(data))
+
+	if v.Kind() == reflect.Struct {
+		if rows, ok := rowsField(v); ok {
+			v = rows
+		}
+	}
+
+	var rows []reflect.Value
+	var rowType reflect.Type
+
+	switch v.Kind() {
+	case reflect.Slice:
+		rowType = v.Type().Elem()
+		for i := 0; i < v.Len(); i++ {
+			rows = append(rows, indirect(v.Index(i)))
+		}
+	case reflect.Struct:
+		rowType = v.Type()
+		rows = append(rows, v)
+	default:
+		return nil, nil, fmt.Errorf("This response is not available as CSV")
+	}
+
+	for rowType.Kind() == reflect.Ptr {
+		rowType = rowType.Elem()
+	}
+	if rowType.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("This response is not available as CSV")
+	}
+
+	columns := csvColumns(rowType, nil)
+
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.name
+	}
+
+	records := make([][]string, len(rows))
+	for i, row := range rows {
+		record := make([]string, len(columns))
+		for j, c := range columns {
+			record[j] = csvValue(fieldByIndex(row, c.index))
+		}
+		records[i] = record
+	}
+
+	return header, records, nil
+}
+
+// comparisonRecords writes one row per date of comparison with the amount and the new
+// amount of each country in columns named after the country slug.
+func comparisonRecords(comparison *store.Comparison) ([]string, [][]string) {
+	header := []string{"date"}
+	for _, series := range comparison.Countries {
+		header = append(header, series.Slug, series.Slug+"-new")
+	}
+
+	records := make([][]string, len(comparison.Dates))
+	for i, date := range comparison.Dates {
+		record := []string{csvValue(reflect.ValueOf(date))}
+		for _, series := range comparison.Countries {
+			record = append(record, csvValue(indirect(reflect.ValueOf(series.Amounts[i]))), csvValue(indirect(reflect.ValueOf(series.New[i]))))
+		}
+		records[i] = record
+	}
+
+	return header, records
+}
+
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+func csvColumns(t reflect.Type, index []int) []csvColumn {
+	columns := []csvColumn{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		fieldIndex := append(append([]int{}, index...), i)
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if fieldType.Kind() == reflect.Struct && fieldType != timeType {
+			if field.Anonymous && name == "" {
+				columns = append(columns, csvColumns(fieldType, fieldIndex)...)
+			}
+			continue
+		}
+
+		switch fieldType.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map, reflect.Interface, reflect.Func, reflect.Chan:
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, csvColumn{name, fieldIndex})
+	}
+
+	return columns
+}
+
+// rowsField returns the only slice of structs in v, if there is exactly one.
+func rowsField(v reflect.Value) (reflect.Value, bool) {
+	var rows reflect.Value
+	found := 0
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" || field.Type.Kind() != reflect.Slice {
+			continue
+		}
+
+		elem := field.Type.Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+
+		if elem.Kind() == reflect.Struct && elem != timeType {
+			rows = v.Field(i)
+			found++
+		}
+	}
+
+	return rows, found == 1
+}
+
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		v = indirect(v)
+		if !v.IsValid() {
+			return v
+		}
+		v = v.Field(i)
+	}
+	return indirect(v)
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func csvValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return ""
+		}
+		if t.Equal(t.Truncate(24 * time.Hour)) {
+			return t.Format(dateLayout)
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	}
+
+	return fmt.Sprint(v.Interface())
+}
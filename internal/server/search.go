@@ -0,0 +1,101 @@
+package server
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jaaanko/covid-19-api/internal/store"
+)
+
+const (
+	maxSuggestions    = 5
+	defaultSearchSize = 10
+	maxSearchSize     = 50
+)
+
+type countryMatch struct {
+	country store.Country
+	score   int
+}
+
+// matchCountries returns at most limit countries whose slug or name is close to query, best match first.
+// Slugs and names starting with the query come first, then those containing it, then the slugs within
+// a small edit distance of it.
+func matchCountries(countries []store.Country, query string, limit int) []store.Country {
+	query = strings.Join(strings.Fields(strings.ToLower(query)), "-")
+
+	matches := []countryMatch{}
+
+	for _, country := range countries {
+		name := strings.Join(strings.Fields(strings.ToLower(country.Name)), "-")
+
+		score := -1
+		switch {
+		case query == "":
+		case strings.HasPrefix(country.Slug, query) || strings.HasPrefix(name, query):
+			score = 0
+		case strings.Contains(country.Slug, query) || strings.Contains(name, query):
+			score = 1
+		default:
+			if d := editDistance(query, country.Slug); d <= maxEditDistance(query) {
+				score = 1 + d
+			}
+		}
+
+		if score >= 0 {
+			matches = append(matches, countryMatch{country, score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score < matches[j].score
+		}
+		return matches[i].country.Slug < matches[j].country.Slug
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	result := make([]store.Country, len(matches))
+	for i, m := range matches {
+		result[i] = m.country
+	}
+	return result
+}
+
+// maxEditDistance allows one typo per three characters of query, and at least two.
+func maxEditDistance(query string) int {
+	if n := len(query) / 3; n > 2 {
+		return n
+	}
+	return 2
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
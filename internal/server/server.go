@@ -1,24 +1,77 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"html/template"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/jaaanko/covid-19-api/internal/analytics"
+	"github.com/jaaanko/covid-19-api/internal/events"
 	"github.com/jaaanko/covid-19-api/internal/store"
 )
 
 type Server struct {
 	store   store.Service
 	handler http.Handler
+	bus     *events.Bus
+	apiKey  string
 }
 
+const (
+	defaultIngestRuns = 10
+	maxIngestRuns     = 100
+)
+
+const maxSmoothWindow = 28
+
+const maxComparedCountries = 10
+
+const defaultRankingLimit = 10
+
+// usSlug is the country slug of the US, the only country reported by county.
+const usSlug = "us"
+
+var errInvalidStatus = errors.New("Invalid status. Please select from the following: confirmed, recoveries, deaths")
+
+const dateLayout = "2006-01-02"
+
+type contextKey int
+
+const timeSeriesQueryKey contextKey = iota
+
 type errorResponse struct {
-	Error string `json:"error"`
+	Error       string          `json:"error"`
+	Suggestions []store.Country `json:"suggestions,omitempty"`
+}
+
+// analyticsQuery holds the smooth, align and derive query parameters of the aggregated time series.
+type analyticsQuery struct {
+	smooth int
+	align  string
+	derive map[string]bool
+}
+
+// Ranking lists the countries with a value for Metric, best ranked first.
+type Ranking struct {
+	Metric    string         `json:"metric"`
+	Order     string         `json:"order"`
+	AsOf      time.Time      `json:"asOf"`
+	Countries []RankingEntry `json:"countries"`
+}
+
+type RankingEntry struct {
+	Rank int `json:"rank"`
+	store.Country
+	Value float64 `json:"value"`
 }
 
 type Route struct {
@@ -33,11 +86,36 @@ func New(store store.Service) *Server {
 
 	router.PathPrefix("/css/").Handler(http.StripPrefix("/css/", fh))
 	router.HandleFunc("/", s.Routes).Methods("GET")
-	router.HandleFunc("/list/countries", s.GetCountries).Methods("GET")
-	router.HandleFunc("/global", s.GetGlobalStats).Methods("GET")
-	router.HandleFunc("/summary", s.GetSummary).Methods("GET")
-	router.Handle("/timeseries/{countryslug}/{status}", StatusMiddleware(http.HandlerFunc(s.GetTimeSeries))).Methods("GET")
-	router.Handle("/timeseries/total/{countryslug}/{status}", StatusMiddleware(http.HandlerFunc(s.GetAggTimeSeries))).Methods("GET")
+
+	// The data only changes with an ingest, so its routes answer conditional requests.
+	conditional := s.ConditionalMiddleware
+	router.Handle("/list/countries", conditional(http.HandlerFunc(s.GetCountries))).Methods("GET")
+	router.Handle("/list/countries/{countryslug}/provinces", conditional(http.HandlerFunc(s.GetProvinces))).Methods("GET")
+	router.Handle("/list/countries/{countryslug}/counties", conditional(http.HandlerFunc(s.GetCounties))).Methods("GET")
+	router.Handle("/global", conditional(http.HandlerFunc(s.GetGlobalStats))).Methods("GET")
+	router.Handle("/summary", conditional(http.HandlerFunc(s.GetSummary))).Methods("GET")
+	router.Handle("/rankings", conditional(http.HandlerFunc(s.GetRankings))).Methods("GET")
+	router.Handle("/regions/{region}/summary", conditional(http.HandlerFunc(s.GetRegionSummary))).Methods("GET")
+	router.Handle("/timeseries/{countryslug}/{status}", conditional(StatusMiddleware(TimeSeriesQueryMiddleware(http.HandlerFunc(s.GetTimeSeries))))).Methods("GET")
+	router.Handle("/timeseries/total/{countryslug}/{status}", conditional(StatusMiddleware(TimeSeriesQueryMiddleware(http.HandlerFunc(s.GetAggTimeSeries))))).Methods("GET")
+	router.Handle("/timeseries/region/{region}/{status}", conditional(StatusMiddleware(TimeSeriesQueryMiddleware(http.HandlerFunc(s.GetRegionTimeSeries))))).Methods("GET")
+	router.Handle("/timeseries/us/{state}/{county}/{status}", conditional(StatusMiddleware(TimeSeriesQueryMiddleware(http.HandlerFunc(s.GetUSCountyTimeSeries))))).Methods("GET")
+	router.Handle("/timeseries/{countryslug}/{province}/{status}", conditional(StatusMiddleware(TimeSeriesQueryMiddleware(http.HandlerFunc(s.GetProvinceTimeSeries))))).Methods("GET")
+	router.Handle("/compare", conditional(TimeSeriesQueryMiddleware(http.HandlerFunc(s.GetComparison)))).Methods("GET")
+	router.Handle("/search/countries", conditional(http.HandlerFunc(s.SearchCountries))).Methods("GET")
+
+	router.HandleFunc("/status/ingest", s.GetIngestRuns).Methods("GET")
+	router.HandleFunc("/status/cache", s.GetCacheStats).Methods("GET")
+	router.HandleFunc("/events", s.StreamEvents).Methods("GET")
+
+	// Subscriptions make the server post to their URL, so they are only managed with the API key.
+	authorized := s.APIKeyMiddleware
+	router.Handle("/subscriptions", authorized(http.HandlerFunc(s.GetSubscriptions))).Methods("GET")
+	router.Handle("/subscriptions", authorized(http.HandlerFunc(s.CreateSubscription))).Methods("POST")
+	router.Handle("/subscriptions/{id}", authorized(http.HandlerFunc(s.GetSubscription))).Methods("GET")
+	router.Handle("/subscriptions/{id}", authorized(http.HandlerFunc(s.UpdateSubscription))).Methods("PUT")
+	router.Handle("/subscriptions/{id}", authorized(http.HandlerFunc(s.DeleteSubscription))).Methods("DELETE")
+	router.Handle("/subscriptions/{id}/deliveries", authorized(http.HandlerFunc(s.GetDeliveries))).Methods("GET")
 
 	s.handler = router
 	return s
@@ -47,18 +125,56 @@ func (s *Server) Run(addr string) error {
 	return http.ListenAndServe(addr, s.handler)
 }
 
-func writeJSONResponse(w http.ResponseWriter, data interface{}) {
-	err := json.NewEncoder(w).Encode(data)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
+func writeError(w http.ResponseWriter, statusCode int, err error) {
+	// Server errors are transient, so they must not be cached like the response they replace.
+	if statusCode >= http.StatusInternalServerError {
+		w.Header().Del("ETag")
+		w.Header().Del("Last-Modified")
+		w.Header().Set("Cache-Control", "no-store")
 	}
-}
 
-func writeError(w http.ResponseWriter, statusCode int, err error) {
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(&errorResponse{Error: err.Error()})
 }
 
+// writeStoreError writes err returned by the store with the matching status code. An unknown
+// country comes with the countries whose slugs are closest to the one requested.
+func (s *Server) writeStoreError(w http.ResponseWriter, err error) {
+	var unknownCountry *store.UnknownCountryError
+
+	switch {
+	case errors.As(err, &unknownCountry):
+		response := &errorResponse{
+			Error: fmt.Sprintf("Unknown country slug %q. Please use a country slug from /list/countries", unknownCountry.Slug),
+		}
+
+		if countries, err := s.store.GetCountries(); err == nil {
+			response.Suggestions = matchCountries(countries, unknownCountry.Slug, maxSuggestions)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+	case errors.Is(err, store.ErrUnknownRegion):
+		regions := make([]string, len(store.Regions))
+		for i, region := range store.Regions {
+			regions[i] = region.Slug
+		}
+		writeError(w, http.StatusNotFound, fmt.Errorf("Unknown region. Please select from the following: %s", strings.Join(regions, ", ")))
+	case errors.Is(err, store.ErrUnknownProvince):
+		writeError(w, http.StatusNotFound, errors.New("Unknown province slug. Please use a province slug from /list/countries/{countryslug}/provinces"))
+	case errors.Is(err, store.ErrUnknownCounty):
+		writeError(w, http.StatusNotFound, errors.New("Unknown county slug. Please use a county slug from /list/countries/{countryslug}/counties"))
+	case errors.Is(err, store.ErrUnknownSubscription):
+		writeError(w, http.StatusNotFound, errors.New("Unknown subscription. Please use an id from /subscriptions"))
+	case errors.Is(err, store.ErrNoData):
+		writeError(w, http.StatusNotFound, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
 func (s *Server) Routes(w http.ResponseWriter, r *http.Request) {
 	dir, err := os.Getwd()
 	if err != nil {
@@ -82,66 +198,528 @@ func (s *Server) GetCountries(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err)
 	} else {
-		writeJSONResponse(w, countries)
+		writeResponse(w, r, countries)
+	}
+}
+
+func (s *Server) GetProvinces(w http.ResponseWriter, r *http.Request) {
+	provinces, err := s.store.GetProvinces(mux.Vars(r)["countryslug"])
+
+	if err != nil {
+		s.writeStoreError(w, err)
+	} else {
+		writeResponse(w, r, provinces)
+	}
+}
+
+// GetCounties lists the counties of a country, or of one of its provinces with ?province=.
+func (s *Server) GetCounties(w http.ResponseWriter, r *http.Request) {
+	counties, err := s.store.GetCounties(mux.Vars(r)["countryslug"], r.URL.Query().Get("province"))
+
+	if err != nil {
+		s.writeStoreError(w, err)
+	} else {
+		writeResponse(w, r, counties)
 	}
 }
 
 func (s *Server) GetGlobalStats(w http.ResponseWriter, r *http.Request) {
-	globalStats, err := s.store.GetGlobalStats()
+	date, err := dateParam(r, "date")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	globalStats, err := s.store.GetGlobalStats(date)
 
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
+		s.writeStoreError(w, err)
 	} else {
-		writeJSONResponse(w, globalStats)
+		writeResponse(w, r, globalStats)
 	}
 }
 
 func (s *Server) GetSummary(w http.ResponseWriter, r *http.Request) {
-	summary, err := s.store.GetSummary()
+	q, err := parseSummaryQuery(r, "sort")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	summary, err := s.store.GetSummary(q)
 
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
+		s.writeStoreError(w, err)
+	} else {
+		writeResponse(w, r, summary)
+	}
+}
+
+func (s *Server) GetRegionSummary(w http.ResponseWriter, r *http.Request) {
+	q, err := parseSummaryQuery(r, "sort")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	q.Region = mux.Vars(r)["region"]
+
+	summary, err := s.store.GetSummary(q)
+
+	if err != nil {
+		s.writeStoreError(w, err)
 	} else {
-		writeJSONResponse(w, summary)
+		writeResponse(w, r, summary)
 	}
 }
 
+func (s *Server) GetRankings(w http.ResponseWriter, r *http.Request) {
+	q, err := parseSummaryQuery(r, "metric")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if q.Sort == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Missing metric. Please select from the following: %s", strings.Join(store.Metrics, ", ")))
+		return
+	}
+
+	if q.Limit == 0 {
+		q.Limit = defaultRankingLimit
+	}
+
+	// Rankings are of countries only.
+	q.Provinces = false
+
+	// Countries without a value for the metric are left out before the ranking is paged, so the
+	// store returns all of them.
+	offset, limit := q.Offset, q.Limit
+	q.Offset, q.Limit = 0, 0
+
+	summary, err := s.store.GetSummary(q)
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+
+	entries := []RankingEntry{}
+
+	for _, locationStats := range summary.LocationStatsList {
+		value := locationStats.Metric(q.Sort)
+		if value == nil {
+			continue
+		}
+
+		entries = append(entries, RankingEntry{
+			Rank:    len(entries) + 1,
+			Country: locationStats.Country,
+			Value:   *value,
+		})
+	}
+
+	if offset >= len(entries) {
+		entries = []RankingEntry{}
+	} else {
+		entries = entries[offset:]
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	writeResponse(w, r, &Ranking{Metric: q.Sort, Order: q.Order, AsOf: summary.AsOf, Countries: entries})
+}
+
 func (s *Server) GetTimeSeries(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	timeSeries, err := s.store.GetTimeSeries(vars["countryslug"], vars["status"])
+	timeSeries, err := s.store.GetTimeSeries(vars["countryslug"], vars["status"], timeSeriesQuery(r))
 
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
+		s.writeStoreError(w, err)
+	} else {
+		writeResponse(w, r, timeSeries)
+	}
+}
+
+func (s *Server) GetProvinceTimeSeries(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	timeSeries, err := s.store.GetProvinceTimeSeries(vars["countryslug"], vars["province"], vars["status"], timeSeriesQuery(r))
+
+	if err != nil {
+		s.writeStoreError(w, err)
+	} else {
+		writeResponse(w, r, timeSeries)
+	}
+}
+
+// GetUSCountyTimeSeries returns the time series of a county of a US state. JHU CSSE does not report
+// recoveries per county.
+func (s *Server) GetUSCountyTimeSeries(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if vars["status"] == store.Recoveries {
+		writeError(w, http.StatusBadRequest, errors.New("Invalid status. Counties only report the following: confirmed, deaths"))
+		return
+	}
+
+	timeSeries, err := s.store.GetCountyTimeSeries(usSlug, vars["state"], vars["county"], vars["status"], timeSeriesQuery(r))
+
+	if err != nil {
+		s.writeStoreError(w, err)
 	} else {
-		writeJSONResponse(w, timeSeries)
+		writeResponse(w, r, timeSeries)
 	}
 }
 
 func (s *Server) GetAggTimeSeries(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	aggTimeSeries, err := s.store.GetAggTimeSeries(vars["countryslug"], vars["status"])
+	aq, err := parseAnalyticsQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	aggTimeSeries, err := s.store.GetAggTimeSeries(vars["countryslug"], vars["status"], timeSeriesQuery(r))
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+
+	if err := s.analyze(aggTimeSeries, vars["countryslug"], vars["status"], timeSeriesQuery(r), aq); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeResponse(w, r, aggTimeSeries)
+}
+
+// analyze adds the values requested by aq to ts, the aggregated time series of status for countrySlug.
+func (s *Server) analyze(ts *store.TimeSeries, countrySlug string, status string, q store.TimeSeriesQuery, aq analyticsQuery) error {
+	if aq.smooth > 0 {
+		analytics.Smooth(ts, aq.smooth, aq.align)
+	}
+
+	if aq.derive[analytics.Growth] {
+		analytics.GrowthRate(ts)
+	}
+
+	if aq.derive[analytics.Doubling] {
+		analytics.DoublingTime(ts)
+	}
+
+	if aq.derive[analytics.CaseFatality] {
+		confirmed, deaths := ts, ts
+
+		var err error
+		if status != store.Confirmed {
+			if confirmed, err = s.store.GetAggTimeSeries(countrySlug, store.Confirmed, q); err != nil {
+				return err
+			}
+		}
+		if status != store.Deaths {
+			if deaths, err = s.store.GetAggTimeSeries(countrySlug, store.Deaths, q); err != nil {
+				return err
+			}
+		}
+
+		analytics.CaseFatalityRatio(ts, confirmed, deaths)
+	}
+
+	return nil
+}
+
+func (s *Server) GetRegionTimeSeries(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	timeSeries, err := s.store.GetRegionTimeSeries(vars["region"], vars["status"], timeSeriesQuery(r))
+
+	if err != nil {
+		s.writeStoreError(w, err)
+	} else {
+		writeResponse(w, r, timeSeries)
+	}
+}
+
+func (s *Server) GetComparison(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	status := params.Get("status")
+	if !isValidStatus(status) {
+		writeError(w, http.StatusBadRequest, errInvalidStatus)
+		return
+	}
+
+	countrySlugs := []string{}
+	seen := make(map[string]bool)
+
+	for _, slug := range strings.Split(params.Get("countries"), ",") {
+		slug = strings.TrimSpace(slug)
+		if slug != "" && !seen[slug] {
+			countrySlugs = append(countrySlugs, slug)
+			seen[slug] = true
+		}
+	}
+
+	if len(countrySlugs) == 0 || len(countrySlugs) > maxComparedCountries {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid countries. Please use 1 to %d country slugs separated by commas", maxComparedCountries))
+		return
+	}
+
+	q := timeSeriesQuery(r)
+	if q.PerCapita {
+		writeError(w, http.StatusBadRequest, errors.New("perCapita is not available for comparisons"))
+		return
+	}
+
+	comparison, err := s.store.GetComparison(countrySlugs, status, q)
+
+	if err != nil {
+		s.writeStoreError(w, err)
+	} else {
+		writeResponse(w, r, comparison)
+	}
+}
+
+func (s *Server) SearchCountries(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	query := strings.TrimSpace(params.Get("q"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, errors.New("Missing q. Please provide part of a country name or slug"))
+		return
+	}
+
+	limit := defaultSearchSize
+
+	if param := params.Get("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > maxSearchSize {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid limit. Please use a number between 1 and %d", maxSearchSize))
+			return
+		}
+		limit = n
+	}
+
+	countries, err := s.store.GetCountries()
 
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err)
 	} else {
-		writeJSONResponse(w, aggTimeSeries)
+		writeResponse(w, r, matchCountries(countries, query, limit))
 	}
 }
 
+func (s *Server) GetIngestRuns(w http.ResponseWriter, r *http.Request) {
+	limit := defaultIngestRuns
+
+	if param := r.URL.Query().Get("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > maxIngestRuns {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid limit. Please use a number between 1 and %d", maxIngestRuns))
+			return
+		}
+		limit = n
+	}
+
+	runs, err := s.store.GetIngestRuns(limit)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+	} else {
+		writeResponse(w, r, runs)
+	}
+}
+
+// GetCacheStats returns the counters of the cache the store reads through, if it does.
+func (s *Server) GetCacheStats(w http.ResponseWriter, r *http.Request) {
+	cached, ok := s.store.(*store.CachedService)
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("The cache is disabled"))
+		return
+	}
+
+	writeResponse(w, r, cached.Stats())
+}
+
+func isValidStatus(status string) bool {
+	return status == store.Confirmed || status == store.Recoveries || status == store.Deaths
+}
+
 func StatusMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 
-		if vars["status"] != store.Confirmed && vars["status"] != store.Recoveries && vars["status"] != store.Deaths {
-			writeError(
-				w,
-				http.StatusBadRequest,
-				errors.New("Invalid status. Please select from the following: confirmed, recoveries, deaths"),
-			)
+		if !isValidStatus(vars["status"]) {
+			writeError(w, http.StatusBadRequest, errInvalidStatus)
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// TimeSeriesQueryMiddleware validates the from, to, limit, order and perCapita query parameters
+// and passes them on to the time series handlers.
+func TimeSeriesQueryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		q := store.TimeSeriesQuery{Order: store.Ascending}
+
+		var err error
+
+		if q.From, err = dateParam(r, "from"); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if q.To, err = dateParam(r, "to"); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if !q.From.IsZero() && !q.To.IsZero() && q.From.After(q.To) {
+			writeError(w, http.StatusBadRequest, errors.New("Invalid date range. from must not be after to"))
+			return
+		}
+
+		if limit := params.Get("limit"); limit != "" {
+			q.Limit, err = strconv.Atoi(limit)
+			if err != nil || q.Limit < 1 {
+				writeError(w, http.StatusBadRequest, errors.New("Invalid limit. Please use a positive number"))
+				return
+			}
+		}
+
+		if order := params.Get("order"); order != "" {
+			if order != store.Ascending && order != store.Descending {
+				writeError(w, http.StatusBadRequest, errors.New("Invalid order. Please select from the following: asc, desc"))
+				return
+			}
+			q.Order = order
+		}
+
+		if perCapita := params.Get("perCapita"); perCapita != "" {
+			q.PerCapita, err = strconv.ParseBool(perCapita)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, errors.New("Invalid perCapita. Please use true or false"))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), timeSeriesQueryKey, q)))
+	})
+}
+
+// parseSummaryQuery validates the date, order, limit, offset, minConfirmed and provinces query parameters
+// along with the metric to sort by in sortParam.
+func parseSummaryQuery(r *http.Request, sortParam string) (store.SummaryQuery, error) {
+	params := r.URL.Query()
+	q := store.SummaryQuery{Order: store.Descending}
+
+	var err error
+
+	if q.Date, err = dateParam(r, "date"); err != nil {
+		return q, err
+	}
+
+	if metric := params.Get(sortParam); metric != "" {
+		if !store.IsMetric(metric) {
+			return q, fmt.Errorf("Invalid %s. Please select from the following: %s", sortParam, strings.Join(store.Metrics, ", "))
+		}
+		q.Sort = metric
+	}
+
+	if order := params.Get("order"); order != "" {
+		if order != store.Ascending && order != store.Descending {
+			return q, errors.New("Invalid order. Please select from the following: asc, desc")
+		}
+		q.Order = order
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil || q.Limit < 1 {
+			return q, errors.New("Invalid limit. Please use a positive number")
+		}
+	}
+
+	if offset := params.Get("offset"); offset != "" {
+		q.Offset, err = strconv.Atoi(offset)
+		if err != nil || q.Offset < 0 {
+			return q, errors.New("Invalid offset. Please use a number of 0 or more")
+		}
+	}
+
+	if minConfirmed := params.Get("minConfirmed"); minConfirmed != "" {
+		q.MinConfirmed, err = strconv.ParseInt(minConfirmed, 10, 64)
+		if err != nil || q.MinConfirmed < 0 {
+			return q, errors.New("Invalid minConfirmed. Please use a number of 0 or more")
+		}
+	}
+
+	if provinces := params.Get("provinces"); provinces != "" {
+		q.Provinces, err = strconv.ParseBool(provinces)
+		if err != nil {
+			return q, errors.New("Invalid provinces. Please use true or false")
+		}
+	}
+
+	return q, nil
+}
+
+// parseAnalyticsQuery validates the smooth, align and derive query parameters.
+func parseAnalyticsQuery(r *http.Request) (analyticsQuery, error) {
+	params := r.URL.Query()
+	aq := analyticsQuery{align: analytics.Trailing, derive: make(map[string]bool)}
+
+	if smooth := params.Get("smooth"); smooth != "" {
+		n, err := strconv.Atoi(smooth)
+		if err != nil || n < 2 || n > maxSmoothWindow {
+			return aq, fmt.Errorf("Invalid smooth. Please use a number of days between 2 and %d", maxSmoothWindow)
+		}
+		aq.smooth = n
+	}
+
+	if align := params.Get("align"); align != "" {
+		if align != analytics.Trailing && align != analytics.Centered {
+			return aq, errors.New("Invalid align. Please select from the following: trailing, centered")
+		}
+		aq.align = align
+	}
+
+	// Without smooth there is no average to place, so align has no effect.
+	if aq.align == analytics.Centered && aq.smooth != 0 && aq.smooth%2 == 0 {
+		return aq, errors.New("Invalid smooth. Please use an odd number of days with align=centered")
+	}
+
+	if derive := params.Get("derive"); derive != "" {
+		for _, value := range strings.Split(derive, ",") {
+			if value != analytics.Growth && value != analytics.Doubling && value != analytics.CaseFatality {
+				return aq, errors.New("Invalid derive. Please select one or more of the following: growth, doubling, cfr")
+			}
+			aq.derive[value] = true
+		}
+	}
+
+	return aq, nil
+}
+
+// dateParam parses the query parameter name as a YYYY-MM-DD date. A missing parameter gives the zero time.
+func dateParam(r *http.Request, name string) (time.Time, error) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return time.Time{}, nil
+	}
+
+	date, err := time.Parse(dateLayout, param)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid %s date. Please use the format YYYY-MM-DD", name)
+	}
+	return date, nil
+}
+
+func timeSeriesQuery(r *http.Request) store.TimeSeriesQuery {
+	q, _ := r.Context().Value(timeSeriesQueryKey).(store.TimeSeriesQuery)
+	return q
+}
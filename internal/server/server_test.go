@@ -1,11 +1,20 @@
 package server_test
 
 import (
+	"bufio"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
+	"github.com/jaaanko/covid-19-api/internal/events"
 	"github.com/jaaanko/covid-19-api/internal/server"
 	"github.com/jaaanko/covid-19-api/internal/store"
 	"github.com/jaaanko/covid-19-api/internal/store/storetest"
@@ -80,7 +89,7 @@ func TestGetCountries(t *testing.T) {
 
 func TestGetGlobalStats(t *testing.T) {
 	st := &storetest.StubStore{
-		GlobalStats: testGlobalStats,
+		GlobalStats: store.GlobalStats{CovidStats: testGlobalStats},
 	}
 
 	server := server.New(st)
@@ -122,6 +131,52 @@ func TestGetGlobalStats(t *testing.T) {
 	}
 }
 
+func TestGetGlobalStatsAsCSV(t *testing.T) {
+	asOf := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	st := &storetest.StubStore{
+		GlobalStats: store.GlobalStats{CovidStats: testGlobalStats, AsOf: asOf},
+	}
+
+	server := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/global", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/csv")
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.GetGlobalStats)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test body: a single row of the totals with their date.
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expectedRows, receivedRows := 2, len(records); receivedRows != expectedRows {
+		t.Fatalf("Wrong amount of rows returned: got %v want %v", receivedRows, expectedRows)
+	}
+
+	row := map[string]string{}
+	for i, name := range records[0] {
+		row[name] = records[1][i]
+	}
+
+	if expectedConfirmed, receivedConfirmed := strconv.FormatInt(testGlobalStats.Confirmed, 10), row["confirmed"]; receivedConfirmed != expectedConfirmed {
+		t.Errorf("Wrong amount of confirmed cases returned: got %v want %v", receivedConfirmed, expectedConfirmed)
+	}
+	if expectedAsOf, receivedAsOf := "2020-03-01", row["asOf"]; !strings.HasPrefix(receivedAsOf, expectedAsOf) {
+		t.Errorf("Wrong asOf returned: got %v want %v", receivedAsOf, expectedAsOf)
+	}
+}
+
 func TestGetSummary(t *testing.T) {
 	locationStatsList := []store.LocationStats{
 		store.LocationStats{
@@ -176,6 +231,128 @@ func TestGetSummary(t *testing.T) {
 	}
 }
 
+func TestGetSummaryWithQuery(t *testing.T) {
+	st := &storetest.StubStore{}
+	s := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/summary?sort=deathsPer100k&order=asc&limit=5&offset=10&minConfirmed=100&provinces=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(s.GetSummary)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test query passed to the store
+	expectedQuery := store.SummaryQuery{Sort: "deathsPer100k", Order: store.Ascending, Limit: 5, Offset: 10, MinConfirmed: 100, Provinces: true}
+
+	if receivedQuery := st.SummaryQuery; receivedQuery != expectedQuery {
+		t.Errorf("Wrong query passed to the store: got %+v want %+v", receivedQuery, expectedQuery)
+	}
+}
+
+func TestGetSummaryWithInvalidQuery(t *testing.T) {
+	st := &storetest.StubStore{}
+	s := server.New(st)
+
+	for _, query := range []string{"sort=population", "order=up", "limit=0", "offset=-1", "minConfirmed=many", "provinces=some"} {
+		req, err := http.NewRequest(http.MethodGet, "/summary?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := httptest.NewRecorder()
+		handler := http.HandlerFunc(s.GetSummary)
+		handler.ServeHTTP(res, req)
+
+		// Test status code
+		if expectedCode, got := http.StatusBadRequest, res.Code; got != expectedCode {
+			t.Errorf("Wrong status code returned for %q: got %v want %v", query, got, expectedCode)
+		}
+	}
+}
+
+func TestGetRankings(t *testing.T) {
+	deathsPer100k := 1.5
+	lowerDeathsPer100k := 0.5
+
+	testLocation3 := store.Location{Country: store.Country{Name: "Test Country 3", Slug: "test-country-3"}}
+
+	// The store lists the countries without a value last.
+	st := &storetest.StubStore{
+		Summary: store.Summary{
+			LocationStatsList: []store.LocationStats{
+				store.LocationStats{Location: testLocation1, PerCapitaStats: store.PerCapitaStats{DeathsPer100k: &deathsPer100k}},
+				store.LocationStats{Location: testLocation3, PerCapitaStats: store.PerCapitaStats{DeathsPer100k: &lowerDeathsPer100k}},
+				store.LocationStats{Location: testLocation2},
+			},
+		},
+	}
+	s := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/rankings?metric=deathsPer100k&offset=1&limit=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(s.GetRankings)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test query passed to the store: the ranking is paged once the countries without a value are left out.
+	expectedQuery := store.SummaryQuery{Sort: "deathsPer100k", Order: store.Descending}
+
+	if receivedQuery := st.SummaryQuery; receivedQuery != expectedQuery {
+		t.Errorf("Wrong query passed to the store: got %+v want %+v", receivedQuery, expectedQuery)
+	}
+
+	// Test body
+	ranking := server.Ranking{}
+	if err := json.Unmarshal(res.Body.Bytes(), &ranking); err != nil {
+		t.Fatal(err)
+	}
+
+	if expectedEntries, receivedEntries := 1, len(ranking.Countries); receivedEntries != expectedEntries {
+		t.Fatalf("Wrong amount of countries returned: got %v want %v", receivedEntries, expectedEntries)
+	}
+
+	expectedEntry := server.RankingEntry{Rank: 2, Country: testLocation3.Country, Value: lowerDeathsPer100k}
+
+	if receivedEntry := ranking.Countries[0]; receivedEntry != expectedEntry {
+		t.Errorf("Wrong country returned: got %+v want %+v", receivedEntry, expectedEntry)
+	}
+}
+
+func TestGetRankingsWithoutMetric(t *testing.T) {
+	st := &storetest.StubStore{}
+	s := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/rankings?limit=20", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(s.GetRankings)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusBadRequest, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+}
+
 func TestGetTimeSeriesWithInvalidStatus(t *testing.T) {
 	st := &storetest.StubStore{}
 	s := server.New(st)
@@ -213,3 +390,1264 @@ func TestGetAggTimeSeriesWithInvalidStatus(t *testing.T) {
 		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
 	}
 }
+
+func TestGetIngestRuns(t *testing.T) {
+	st := &storetest.StubStore{
+		IngestRuns: []store.IngestRun{
+			store.IngestRun{ID: 2, Series: store.RecoveriesRun, RowsInserted: 10},
+			store.IngestRun{ID: 1, Series: store.ConfirmedAndDeathsRun, Error: "connection refused"},
+		},
+	}
+	server := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/status/ingest?limit=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.GetIngestRuns)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test body
+	runs := []store.IngestRun{}
+
+	err = json.Unmarshal(res.Body.Bytes(), &runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expectedRuns, receivedRuns := 1, len(runs); receivedRuns != expectedRuns {
+		t.Fatalf("Wrong amount of runs returned: got %v want %v", receivedRuns, expectedRuns)
+	}
+
+	if expectedID, receivedID := int64(2), runs[0].ID; receivedID != expectedID {
+		t.Errorf("Wrong run returned: got %v want %v", receivedID, expectedID)
+	}
+}
+
+func TestGetIngestRunsWithInvalidLimit(t *testing.T) {
+	st := &storetest.StubStore{}
+	server := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/status/ingest?limit=abc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.GetIngestRuns)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusBadRequest, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+}
+
+func TestGetAggTimeSeriesWithQuery(t *testing.T) {
+	st := &storetest.StubStore{}
+	s := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/timeseries/total/country-slug/confirmed?from=2020-03-01&to=2020-03-31&limit=7&order=desc&perCapita=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := server.TimeSeriesQueryMiddleware(http.HandlerFunc(s.GetAggTimeSeries))
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test query passed to the store
+	expectedQuery := store.TimeSeriesQuery{
+		From:      time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+		To:        time.Date(2020, 3, 31, 0, 0, 0, 0, time.UTC),
+		Limit:     7,
+		Order:     store.Descending,
+		PerCapita: true,
+	}
+
+	if receivedQuery := st.TimeSeriesQuery; receivedQuery != expectedQuery {
+		t.Errorf("Wrong query passed to the store: got %+v want %+v", receivedQuery, expectedQuery)
+	}
+}
+
+func TestGetTimeSeriesWithInvalidQuery(t *testing.T) {
+	st := &storetest.StubStore{}
+	s := server.New(st)
+
+	for _, query := range []string{"from=2020-13-01", "to=yesterday", "from=2020-03-02&to=2020-03-01", "limit=0", "order=up", "perCapita=maybe"} {
+		req, err := http.NewRequest(http.MethodGet, "/timeseries/country-slug/confirmed?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := httptest.NewRecorder()
+		handler := server.TimeSeriesQueryMiddleware(http.HandlerFunc(s.GetTimeSeries))
+		handler.ServeHTTP(res, req)
+
+		// Test status code
+		if expectedCode, got := http.StatusBadRequest, res.Code; got != expectedCode {
+			t.Errorf("Wrong status code returned for %q: got %v want %v", query, got, expectedCode)
+		}
+	}
+}
+
+func TestGetSummaryAsCSV(t *testing.T) {
+	st := &storetest.StubStore{
+		Summary: store.Summary{
+			CovidStats: testGlobalStats,
+			LocationStatsList: []store.LocationStats{
+				store.LocationStats{Location: testLocation1, CovidStats: testCountry1Stats},
+				store.LocationStats{Location: testLocation2, CovidStats: testCountry2Stats},
+			},
+		},
+	}
+	server := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/summary", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/csv")
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.GetSummary)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test body
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedHeader := []string{"countryName", "countrySlug", "iso2", "iso3", "continent", "whoRegion", "province", "provinceSlug", "county", "countySlug", "fips", "latitude", "longitude",
+		"confirmed", "newConfirmed", "recovered", "newRecovered", "deaths", "newDeaths",
+		"population", "confirmedPer100k", "newConfirmedPer100k", "deathsPer100k", "active", "incidenceRate", "lastUpdate"}
+
+	if receivedHeader := records[0]; strings.Join(receivedHeader, ",") != strings.Join(expectedHeader, ",") {
+		t.Errorf("Wrong header returned: got %v want %v", receivedHeader, expectedHeader)
+	}
+
+	if expectedRows, receivedRows := 3, len(records); receivedRows != expectedRows {
+		t.Fatalf("Wrong amount of rows returned: got %v want %v", receivedRows, expectedRows)
+	}
+
+	if expectedConfirmed, receivedConfirmed := "88", records[2][13]; receivedConfirmed != expectedConfirmed {
+		t.Errorf("Wrong amount of confirmed cases returned: got %v want %v", receivedConfirmed, expectedConfirmed)
+	}
+}
+
+func TestGetAggTimeSeriesAsCSV(t *testing.T) {
+	st := &storetest.StubStore{
+		AggTimeSeries: store.TimeSeries{
+			DataPoints: []store.TimeSeriesDataPoint{
+				store.TimeSeriesDataPoint{
+					Location: store.Location{Country: testCountry1},
+					Amount:   23,
+					New:      1,
+					Status:   store.Confirmed,
+					Date:     time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+	}
+	s := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/timeseries/total/test-country-1/confirmed?format=csv", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(s.GetAggTimeSeries)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test body
+	expectedBody := "countryName,countrySlug,iso2,iso3,continent,whoRegion,province,provinceSlug,county,countySlug,fips,latitude,longitude,amount,new,status,date," +
+		"population,amountPer100k,newPer100k,newAvg,growthRate,doublingTime,caseFatalityRatio\n" +
+		"Test Country 1,test-country-1,,,,,,,,,,0,0,23,1,confirmed,2020-03-01,,,,,,,\n"
+
+	if receivedBody := res.Body.String(); receivedBody != expectedBody {
+		t.Errorf("Wrong body returned: got %q want %q", receivedBody, expectedBody)
+	}
+}
+
+func TestGetAggTimeSeriesWithAnalytics(t *testing.T) {
+	st := &storetest.StubStore{
+		AggTimeSeries: store.TimeSeries{
+			DataPoints: []store.TimeSeriesDataPoint{
+				store.TimeSeriesDataPoint{Amount: 10, New: 10, Status: store.Confirmed, Date: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)},
+				store.TimeSeriesDataPoint{Amount: 20, New: 10, Status: store.Confirmed, Date: time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)},
+				store.TimeSeriesDataPoint{Amount: 50, New: 30, Status: store.Confirmed, Date: time.Date(2020, 3, 3, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+	}
+	s := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/timeseries/total/test-country-1/confirmed?smooth=2&derive=growth,doubling", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(s.GetAggTimeSeries)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test body
+	var timeSeries store.TimeSeries
+	if err := json.NewDecoder(res.Body).Decode(&timeSeries); err != nil {
+		t.Fatal(err)
+	}
+
+	last := timeSeries.DataPoints[2]
+
+	if last.NewAvg == nil || last.GrowthRate == nil || last.DoublingTime == nil {
+		t.Fatalf("Missing derived values: got %+v", last)
+	}
+
+	if expectedAvg, receivedAvg := 20.0, *last.NewAvg; receivedAvg != expectedAvg {
+		t.Errorf("Wrong newAvg returned: got %v want %v", receivedAvg, expectedAvg)
+	}
+
+	if expectedGrowth, receivedGrowth := 1.0, *last.GrowthRate; receivedGrowth != expectedGrowth {
+		t.Errorf("Wrong growthRate returned: got %v want %v", receivedGrowth, expectedGrowth)
+	}
+
+	if first := timeSeries.DataPoints[0]; first.NewAvg != nil || first.GrowthRate != nil {
+		t.Errorf("Derived values returned without enough data: got %+v", first)
+	}
+}
+
+func TestGetAggTimeSeriesCenteredWithoutSmooth(t *testing.T) {
+	st := &storetest.StubStore{}
+	s := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/timeseries/total/country-slug/confirmed?align=centered", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(s.GetAggTimeSeries)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+}
+
+func TestGetAggTimeSeriesWithInvalidAnalytics(t *testing.T) {
+	st := &storetest.StubStore{}
+	s := server.New(st)
+
+	for _, query := range []string{"smooth=1", "smooth=week", "smooth=29", "smooth=6&align=centered", "align=left", "derive=growth,speed"} {
+		req, err := http.NewRequest(http.MethodGet, "/timeseries/total/country-slug/confirmed?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := httptest.NewRecorder()
+		handler := http.HandlerFunc(s.GetAggTimeSeries)
+		handler.ServeHTTP(res, req)
+
+		// Test status code
+		if expectedCode, got := http.StatusBadRequest, res.Code; got != expectedCode {
+			t.Errorf("Wrong status code returned for %q: got %v want %v", query, got, expectedCode)
+		}
+	}
+}
+
+func TestGetComparison(t *testing.T) {
+	amount, newAmount := int64(12), int64(2)
+
+	st := &storetest.StubStore{
+		Comparison: store.Comparison{
+			Status: store.Confirmed,
+			Dates:  []time.Time{time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)},
+			Countries: []store.ComparisonSeries{
+				store.ComparisonSeries{Country: testCountry1, Amounts: []*int64{&amount}, New: []*int64{&newAmount}},
+				store.ComparisonSeries{Country: testCountry2, Amounts: []*int64{nil}, New: []*int64{nil}},
+			},
+		},
+	}
+	s := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/compare?countries=test-country-1,test-country-2,test-country-1&status=confirmed&format=csv", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := server.TimeSeriesQueryMiddleware(http.HandlerFunc(s.GetComparison))
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test countries passed to the store
+	if expected, got := "test-country-1,test-country-2", strings.Join(st.ComparedCountries, ","); got != expected {
+		t.Errorf("Wrong countries passed to the store: got %v want %v", got, expected)
+	}
+
+	// Test body
+	expectedBody := "date,test-country-1,test-country-1-new,test-country-2,test-country-2-new\n" +
+		"2020-03-01,12,2,,\n"
+
+	if receivedBody := res.Body.String(); receivedBody != expectedBody {
+		t.Errorf("Wrong body returned: got %q want %q", receivedBody, expectedBody)
+	}
+}
+
+func TestGetComparisonWithInvalidQuery(t *testing.T) {
+	st := &storetest.StubStore{}
+	s := server.New(st)
+
+	for _, query := range []string{
+		"countries=italy",
+		"countries=italy&status=active",
+		"countries=,&status=confirmed",
+		"countries=a,b,c,d,e,f,g,h,i,j,k&status=confirmed",
+		"countries=italy&status=confirmed&perCapita=true",
+	} {
+		req, err := http.NewRequest(http.MethodGet, "/compare?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := httptest.NewRecorder()
+		handler := server.TimeSeriesQueryMiddleware(http.HandlerFunc(s.GetComparison))
+		handler.ServeHTTP(res, req)
+
+		// Test status code
+		if expectedCode, got := http.StatusBadRequest, res.Code; got != expectedCode {
+			t.Errorf("Wrong status code returned for %q: got %v want %v", query, got, expectedCode)
+		}
+	}
+}
+
+func TestGetTimeSeriesWithUnknownCountry(t *testing.T) {
+	st := &storetest.StubStore{
+		Countries: []store.Country{
+			store.Country{Name: "Italy", Slug: "italy"},
+			store.Country{Name: "Ireland", Slug: "ireland"},
+			store.Country{Name: "India", Slug: "india"},
+		},
+	}
+	s := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/timeseries/itlay/confirmed", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"countryslug": "itlay", "status": store.Confirmed})
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(s.GetTimeSeries)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusNotFound, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test body
+	var body struct {
+		Error       string          `json:"error"`
+		Suggestions []store.Country `json:"suggestions"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body.Suggestions) == 0 || body.Suggestions[0].Slug != "italy" {
+		t.Errorf("Wrong suggestions returned: got %v want italy first", body.Suggestions)
+	}
+}
+
+func TestGetProvinces(t *testing.T) {
+	st := &storetest.StubStore{
+		Countries: []store.Country{testCountry1},
+		Provinces: []store.Province{
+			store.Province{Country: testCountry1, Name: "Test Province", Slug: "test-province"},
+		},
+	}
+	s := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/list/countries/test-country-1/provinces", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"countryslug": "test-country-1"})
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(s.GetProvinces)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test body
+	var provinces []store.Province
+	if err := json.Unmarshal(res.Body.Bytes(), &provinces); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(provinces) != 1 || provinces[0].Slug != "test-province" || provinces[0].Country.Slug != "test-country-1" {
+		t.Errorf("Wrong provinces returned: got %+v want test-province of test-country-1", provinces)
+	}
+}
+
+func TestGetProvinceTimeSeriesWithUnknownProvince(t *testing.T) {
+	st := &storetest.StubStore{
+		Countries: []store.Country{testCountry1},
+		Provinces: []store.Province{
+			store.Province{Country: testCountry1, Name: "Test Province", Slug: "test-province"},
+		},
+	}
+	s := server.New(st)
+
+	for province, expectedCode := range map[string]int{"test-province": http.StatusOK, "atlantis": http.StatusNotFound} {
+		req, err := http.NewRequest(http.MethodGet, "/timeseries/test-country-1/"+province+"/confirmed", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"countryslug": "test-country-1", "province": province, "status": store.Confirmed})
+
+		res := httptest.NewRecorder()
+		handler := http.HandlerFunc(s.GetProvinceTimeSeries)
+		handler.ServeHTTP(res, req)
+
+		// Test status code
+		if got := res.Code; got != expectedCode {
+			t.Errorf("Wrong status code returned for %q: got %v want %v", province, got, expectedCode)
+		}
+	}
+}
+
+func TestGetCounties(t *testing.T) {
+	newYork := store.Province{Country: store.Country{Name: "US", Slug: "us"}, Name: "New York", Slug: "new-york"}
+	st := &storetest.StubStore{
+		Counties: []store.County{
+			store.County{Province: newYork, Name: "Westchester", Slug: "westchester", FIPS: "36119"},
+		},
+	}
+	s := server.New(st)
+
+	for province, expectedCode := range map[string]int{"new-york": http.StatusOK, "atlantis": http.StatusNotFound} {
+		req, err := http.NewRequest(http.MethodGet, "/list/countries/us/counties?province="+province, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"countryslug": "us"})
+
+		res := httptest.NewRecorder()
+		handler := http.HandlerFunc(s.GetCounties)
+		handler.ServeHTTP(res, req)
+
+		// Test status code
+		if got := res.Code; got != expectedCode {
+			t.Errorf("Wrong status code returned for %q: got %v want %v", province, got, expectedCode)
+		}
+	}
+}
+
+func TestGetUSCountyTimeSeries(t *testing.T) {
+	st := &storetest.StubStore{}
+	s := server.New(st)
+
+	for status, expectedCode := range map[string]int{store.Deaths: http.StatusOK, store.Recoveries: http.StatusBadRequest} {
+		req, err := http.NewRequest(http.MethodGet, "/timeseries/us/new-york/westchester/"+status, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"state": "new-york", "county": "westchester", "status": status})
+
+		res := httptest.NewRecorder()
+		handler := http.HandlerFunc(s.GetUSCountyTimeSeries)
+		handler.ServeHTTP(res, req)
+
+		// Test status code
+		if got := res.Code; got != expectedCode {
+			t.Errorf("Wrong status code returned for %q: got %v want %v", status, got, expectedCode)
+		}
+	}
+}
+
+func TestSearchCountries(t *testing.T) {
+	st := &storetest.StubStore{
+		Countries: []store.Country{
+			store.Country{Name: "United Kingdom", Slug: "united-kingdom"},
+			store.Country{Name: "United Arab Emirates", Slug: "united-arab-emirates"},
+			store.Country{Name: "Tanzania", Slug: "tanzania"},
+			store.Country{Name: "Germany", Slug: "germany"},
+		},
+	}
+	s := server.New(st)
+
+	for _, test := range []struct {
+		query    string
+		expected string
+	}{
+		{"united", "united-arab-emirates,united-kingdom"},
+		{"United K", "united-kingdom"},
+		{"kingdom", "united-kingdom"},
+		{"germny", "germany"},
+		{"xyz", ""},
+	} {
+		req, err := http.NewRequest(http.MethodGet, "/search/countries?q="+url.QueryEscape(test.query), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := httptest.NewRecorder()
+		handler := http.HandlerFunc(s.SearchCountries)
+		handler.ServeHTTP(res, req)
+
+		// Test status code
+		if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+			t.Errorf("Wrong status code returned for %q: got %v want %v", test.query, got, expectedCode)
+		}
+
+		// Test body
+		countries := []store.Country{}
+		if err := json.Unmarshal(res.Body.Bytes(), &countries); err != nil {
+			t.Fatal(err)
+		}
+
+		slugs := []string{}
+		for _, country := range countries {
+			slugs = append(slugs, country.Slug)
+		}
+
+		if received := strings.Join(slugs, ","); received != test.expected {
+			t.Errorf("Wrong countries returned for %q: got %v want %v", test.query, received, test.expected)
+		}
+	}
+}
+
+func TestSearchCountriesWithInvalidQuery(t *testing.T) {
+	st := &storetest.StubStore{}
+	s := server.New(st)
+
+	for _, query := range []string{"", "q=+", "q=italy&limit=0", "q=italy&limit=51"} {
+		req, err := http.NewRequest(http.MethodGet, "/search/countries?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := httptest.NewRecorder()
+		handler := http.HandlerFunc(s.SearchCountries)
+		handler.ServeHTTP(res, req)
+
+		// Test status code
+		if expectedCode, got := http.StatusBadRequest, res.Code; got != expectedCode {
+			t.Errorf("Wrong status code returned for %q: got %v want %v", query, got, expectedCode)
+		}
+	}
+}
+
+func TestGetRegionSummary(t *testing.T) {
+	st := &storetest.StubStore{}
+	s := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/regions/europe/summary?sort=confirmed&limit=3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"region": "europe"})
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(s.GetRegionSummary)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test query passed to the store
+	expectedQuery := store.SummaryQuery{Region: "europe", Sort: "confirmed", Order: store.Descending, Limit: 3}
+
+	if receivedQuery := st.SummaryQuery; receivedQuery != expectedQuery {
+		t.Errorf("Wrong query passed to the store: got %+v want %+v", receivedQuery, expectedQuery)
+	}
+}
+
+func TestGetCountriesWithInvalidFormat(t *testing.T) {
+	st := &storetest.StubStore{}
+	server := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/list/countries?format=xml", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.GetCountries)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusBadRequest, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+}
+
+func TestGetSummaryOnDate(t *testing.T) {
+	st := &storetest.StubStore{
+		Summary: store.Summary{
+			CovidStats: testGlobalStats,
+			AsOf:       time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	server := server.New(st)
+
+	for query, expectedCode := range map[string]int{
+		"date=2020-06-01": http.StatusOK,
+		"date=2020-06-02": http.StatusNotFound,
+		"date=06/01/2020": http.StatusBadRequest,
+	} {
+		req, err := http.NewRequest(http.MethodGet, "/summary?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.GetSummary)
+		handler.ServeHTTP(res, req)
+
+		// Test status code
+		if got := res.Code; got != expectedCode {
+			t.Errorf("Wrong status code returned for %q: got %v want %v", query, got, expectedCode)
+		}
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	asOf := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	st := &storetest.StubStore{
+		GlobalStats: store.GlobalStats{AsOf: asOf},
+	}
+	s := server.New(st)
+
+	bus := events.NewBus(10)
+	defer bus.Close()
+	s.Listen(bus)
+
+	updates, cancel := bus.Subscribe(0)
+	defer cancel()
+
+	// Counties do not change the summaries, so only the other updates are published.
+	bus.Publish(events.IngestCompleted, &store.IngestReport{
+		IngestRun: store.IngestRun{Series: store.ConfirmedAndDeathsRun},
+		Countries: []string{"test-country-1"},
+	})
+	bus.Publish(events.IngestCompleted, &store.IngestReport{
+		IngestRun: store.IngestRun{Series: store.USCountiesRun},
+		Countries: []string{"us"},
+	})
+	bus.Publish(events.IngestCompleted, &store.IngestReport{
+		IngestRun: store.IngestRun{Series: store.RecoveriesRun},
+		Countries: []string{"test-country-2"},
+	})
+
+	var published []events.Event
+	for event := range updates {
+		if event.Type == events.SummaryUpdated {
+			published = append(published, event)
+			if len(published) == 2 {
+				break
+			}
+		}
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(s.StreamEvents))
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", strconv.FormatUint(published[0].ID, 10))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.StatusCode; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	if expected, got := "text/event-stream", res.Header.Get("Content-Type"); got != expected {
+		t.Errorf("Wrong content type returned: got %v want %v", got, expected)
+	}
+
+	// Test body: the event missed since Last-Event-ID is sent first.
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(res.Body)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" && fields["event"] != "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ": "); ok {
+			fields[name] = value
+		}
+	}
+
+	if expectedID, receivedID := strconv.FormatUint(published[1].ID, 10), fields["id"]; receivedID != expectedID {
+		t.Errorf("Wrong event id returned: got %v want %v", receivedID, expectedID)
+	}
+	if expectedEvent, receivedEvent := events.SummaryUpdated, fields["event"]; receivedEvent != expectedEvent {
+		t.Errorf("Wrong event returned: got %v want %v", receivedEvent, expectedEvent)
+	}
+
+	update := server.SummaryUpdate{}
+
+	err = json.Unmarshal([]byte(fields["data"]), &update)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !update.AsOf.Equal(asOf) {
+		t.Errorf("Wrong asOf returned: got %v want %v", update.AsOf, asOf)
+	}
+	if expectedSeries, receivedSeries := store.RecoveriesRun, update.Series; receivedSeries != expectedSeries {
+		t.Errorf("Wrong series returned: got %v want %v", receivedSeries, expectedSeries)
+	}
+	if len(update.Countries) != 1 || update.Countries[0] != "test-country-2" {
+		t.Errorf("Wrong countries returned: got %v want [test-country-2]", update.Countries)
+	}
+}
+
+func TestStreamEventsWithoutBus(t *testing.T) {
+	server := server.New(&storetest.StubStore{})
+
+	req, err := http.NewRequest(http.MethodGet, "/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.StreamEvents)
+	handler.ServeHTTP(res, req)
+
+	if expectedCode, got := http.StatusServiceUnavailable, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+}
+
+func TestCreateSubscription(t *testing.T) {
+	st := &storetest.StubStore{
+		Countries: []store.Country{testCountry1},
+	}
+	server := server.New(st)
+
+	body := `{"url":"https://example.com/hook","countrySlug":"test-country-1","metric":"confirmed","rule":"growth","threshold":20}`
+
+	req, err := http.NewRequest(http.MethodPost, "/subscriptions", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.CreateSubscription)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusCreated, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	if expected, got := "/subscriptions/1", res.Header().Get("Location"); got != expected {
+		t.Errorf("Wrong location returned: got %v want %v", got, expected)
+	}
+
+	// Test body: the generated secret is returned once.
+	sub := store.Subscription{}
+
+	err = json.Unmarshal(res.Body.Bytes(), &sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sub.Secret == "" {
+		t.Errorf("Wrong secret returned: got an empty secret")
+	}
+	if expectedRule, receivedRule := store.GrowthRule, sub.Rule; receivedRule != expectedRule {
+		t.Errorf("Wrong rule returned: got %v want %v", receivedRule, expectedRule)
+	}
+	if expectedSecret, storedSecret := sub.Secret, st.Subscriptions[0].Secret; storedSecret != expectedSecret {
+		t.Errorf("Wrong secret stored: got %v want %v", storedSecret, expectedSecret)
+	}
+}
+
+func TestCreateSubscriptionWithInvalidBody(t *testing.T) {
+	st := &storetest.StubStore{
+		Countries: []store.Country{testCountry1},
+	}
+	server := server.New(st)
+
+	bodies := map[string]int{
+		`not json`: http.StatusBadRequest,
+		`{"url":"example.com","countrySlug":"test-country-1","metric":"confirmed","rule":"above"}`:         http.StatusBadRequest,
+		`{"url":"https://example.com","metric":"confirmed","rule":"above"}`:                                http.StatusBadRequest,
+		`{"url":"https://example.com","countrySlug":"test-country-1","metric":"active","rule":"above"}`:    http.StatusBadRequest,
+		`{"url":"https://example.com","countrySlug":"test-country-1","metric":"deaths","rule":"below"}`:    http.StatusBadRequest,
+		`{"url":"https://example.com","countrySlug":"test-country-2","metric":"deaths","rule":"above"}`:    http.StatusNotFound,
+		`{"url":"https://example.com","countrySlug":"test-country-1","metric":"deaths","rule":"above"}`:    http.StatusCreated,
+		`{"url":"http://localhost:8080","countrySlug":"test-country-1","metric":"deaths","rule":"growth"}`: http.StatusBadRequest,
+		`{"url":"http://10.0.0.8/hook","countrySlug":"test-country-1","metric":"deaths","rule":"growth"}`:  http.StatusBadRequest,
+		`{"url":"http://169.254.169.254","countrySlug":"test-country-1","metric":"deaths","rule":"above"}`: http.StatusBadRequest,
+		`{"url":"http://[::1]:8080","countrySlug":"test-country-1","metric":"deaths","rule":"above"}`:      http.StatusBadRequest,
+	}
+
+	for body, expectedCode := range bodies {
+		req, err := http.NewRequest(http.MethodPost, "/subscriptions", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.CreateSubscription)
+		handler.ServeHTTP(res, req)
+
+		if got := res.Code; got != expectedCode {
+			t.Errorf("Wrong status code returned for %s: got %v want %v", body, got, expectedCode)
+		}
+	}
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	s := server.New(&storetest.StubStore{})
+	s.SetAPIKey("k3y")
+	handler := s.APIKeyMiddleware(http.HandlerFunc(s.GetSubscriptions))
+
+	headers := map[string]int{
+		"":            http.StatusUnauthorized,
+		"k3y":         http.StatusUnauthorized,
+		"Bearer":      http.StatusUnauthorized,
+		"Bearer k3":   http.StatusUnauthorized,
+		"Bearer k3y":  http.StatusOK,
+		"Basic azN5":  http.StatusUnauthorized,
+		"Bearer k3y ": http.StatusUnauthorized,
+	}
+
+	for header, expectedCode := range headers {
+		req, err := http.NewRequest(http.MethodGet, "/subscriptions", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		if got := res.Code; got != expectedCode {
+			t.Errorf("Wrong status code returned for %q: got %v want %v", header, got, expectedCode)
+		}
+	}
+}
+
+func TestAPIKeyMiddlewareWithoutKey(t *testing.T) {
+	s := server.New(&storetest.StubStore{})
+	handler := s.APIKeyMiddleware(http.HandlerFunc(s.GetSubscriptions))
+
+	req, err := http.NewRequest(http.MethodGet, "/subscriptions", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer ")
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	if expectedCode, got := http.StatusServiceUnavailable, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+}
+
+func TestGetSubscriptions(t *testing.T) {
+	st := &storetest.StubStore{
+		Subscriptions: []store.Subscription{
+			{ID: 1, URL: "https://example.com/hook", Secret: "s3cret", CountrySlug: "test-country-1", Metric: store.Confirmed, Rule: store.AboveRule},
+		},
+	}
+	server := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/subscriptions", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.GetSubscriptions)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test body: secrets are not listed.
+	subs := []store.Subscription{}
+
+	err = json.Unmarshal(res.Body.Bytes(), &subs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expectedSubs, receivedSubs := 1, len(subs); receivedSubs != expectedSubs {
+		t.Fatalf("Wrong amount of subscriptions returned: got %v want %v", receivedSubs, expectedSubs)
+	}
+	if receivedSecret := subs[0].Secret; receivedSecret != "" {
+		t.Errorf("Wrong secret returned: got %v want none", receivedSecret)
+	}
+	if storedSecret := st.Subscriptions[0].Secret; storedSecret != "s3cret" {
+		t.Errorf("Wrong secret stored: got %v want s3cret", storedSecret)
+	}
+}
+
+func TestUpdateSubscription(t *testing.T) {
+	st := &storetest.StubStore{
+		Subscriptions: []store.Subscription{
+			{ID: 1, URL: "https://example.com/hook", Secret: "s3cret", CountrySlug: "test-country-1", Metric: store.Confirmed, Rule: store.AboveRule},
+		},
+	}
+	server := server.New(st)
+
+	body := `{"url":"https://example.com/hook","countrySlug":"test-country-1","metric":"deaths","rule":"above","threshold":10}`
+
+	req, err := http.NewRequest(http.MethodPut, "/subscriptions/1", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.UpdateSubscription)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test stored subscription: the secret is kept.
+	stored := st.Subscriptions[0]
+
+	if expectedMetric, storedMetric := store.Deaths, stored.Metric; storedMetric != expectedMetric {
+		t.Errorf("Wrong metric stored: got %v want %v", storedMetric, expectedMetric)
+	}
+	if storedSecret := stored.Secret; storedSecret != "s3cret" {
+		t.Errorf("Wrong secret stored: got %v want s3cret", storedSecret)
+	}
+}
+
+func TestDeleteSubscription(t *testing.T) {
+	st := &storetest.StubStore{
+		Subscriptions: []store.Subscription{
+			{ID: 1, URL: "https://example.com/hook", CountrySlug: "test-country-1", Metric: store.Confirmed, Rule: store.AboveRule},
+		},
+	}
+	server := server.New(st)
+
+	ids := []struct {
+		id           string
+		expectedCode int
+	}{
+		{"1", http.StatusNoContent},
+		{"1", http.StatusNotFound},
+		{"abc", http.StatusBadRequest},
+	}
+
+	for _, test := range ids {
+		req, err := http.NewRequest(http.MethodDelete, "/subscriptions/"+test.id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": test.id})
+
+		res := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.DeleteSubscription)
+		handler.ServeHTTP(res, req)
+
+		if got := res.Code; got != test.expectedCode {
+			t.Errorf("Wrong status code returned for %s: got %v want %v", test.id, got, test.expectedCode)
+		}
+	}
+}
+
+func TestGetDeliveries(t *testing.T) {
+	statusCode := http.StatusOK
+	st := &storetest.StubStore{
+		Subscriptions: []store.Subscription{
+			{ID: 1, URL: "https://example.com/hook", CountrySlug: "test-country-1", Metric: store.Confirmed, Rule: store.AboveRule},
+		},
+		Deliveries: []store.Delivery{
+			{ID: 1, SubscriptionID: 1, Attempt: 1, Error: "connection refused", Payload: []byte(`{}`)},
+			{ID: 2, SubscriptionID: 1, Attempt: 2, StatusCode: &statusCode, Payload: []byte(`{}`)},
+		},
+	}
+	server := server.New(st)
+
+	req, err := http.NewRequest(http.MethodGet, "/subscriptions/1/deliveries?limit=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.GetDeliveries)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test body
+	deliveries := []store.Delivery{}
+
+	err = json.Unmarshal(res.Body.Bytes(), &deliveries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expectedDeliveries, receivedDeliveries := 1, len(deliveries); receivedDeliveries != expectedDeliveries {
+		t.Fatalf("Wrong amount of deliveries returned: got %v want %v", receivedDeliveries, expectedDeliveries)
+	}
+	if expectedID, receivedID := int64(2), deliveries[0].ID; receivedID != expectedID {
+		t.Errorf("Wrong delivery returned: got %v want %v", receivedID, expectedID)
+	}
+}
+
+func TestConditionalMiddleware(t *testing.T) {
+	lastIngest := time.Date(2020, 3, 1, 12, 30, 15, 500, time.UTC)
+	st := &storetest.StubStore{
+		Summary:    store.Summary{CovidStats: testGlobalStats},
+		LastIngest: lastIngest,
+	}
+	s := server.New(st)
+	handler := s.ConditionalMiddleware(http.HandlerFunc(s.GetSummary))
+
+	req, err := http.NewRequest(http.MethodGet, "/summary", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test headers
+	etag := res.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("Wrong ETag returned: got none")
+	}
+
+	if expected, got := "Sun, 01 Mar 2020 12:30:15 GMT", res.Header().Get("Last-Modified"); got != expected {
+		t.Errorf("Wrong Last-Modified returned: got %v want %v", got, expected)
+	}
+
+	if expected, got := "public, max-age=300", res.Header().Get("Cache-Control"); got != expected {
+		t.Errorf("Wrong Cache-Control returned: got %v want %v", got, expected)
+	}
+
+	// Test conditional requests
+	tests := []struct {
+		header       string
+		value        string
+		format       string
+		expectedCode int
+	}{
+		{"If-None-Match", etag, "", http.StatusNotModified},
+		{"If-None-Match", `"other", W/` + etag, "", http.StatusNotModified},
+		{"If-None-Match", `"other"`, "", http.StatusOK},
+		{"If-None-Match", etag, "csv", http.StatusOK},
+		{"If-Modified-Since", "Sun, 01 Mar 2020 12:30:15 GMT", "", http.StatusNotModified},
+		{"If-Modified-Since", "Sun, 01 Mar 2020 12:30:14 GMT", "", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		target := "/summary"
+		if test.format != "" {
+			target += "?format=" + test.format
+		}
+
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(test.header, test.value)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		if got := res.Code; got != test.expectedCode {
+			t.Errorf("Wrong status code returned for %s: %s on %s: got %v want %v", test.header, test.value, target, got, test.expectedCode)
+		}
+		if test.expectedCode == http.StatusNotModified && res.Body.Len() != 0 {
+			t.Errorf("Wrong body returned for %s: %s: got %q want none", test.header, test.value, res.Body.String())
+		}
+	}
+}
+
+func TestConditionalMiddlewareWithoutIngest(t *testing.T) {
+	s := server.New(&storetest.StubStore{})
+	handler := s.ConditionalMiddleware(http.HandlerFunc(s.GetSummary))
+
+	req, err := http.NewRequest(http.MethodGet, "/summary", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-Modified-Since", "Sun, 01 Mar 2020 12:30:15 GMT")
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+	if etag := res.Header().Get("ETag"); etag != "" {
+		t.Errorf("Wrong ETag returned: got %v want none", etag)
+	}
+}
+
+func TestConditionalMiddlewareWithError(t *testing.T) {
+	lastIngest := time.Date(2020, 3, 1, 12, 30, 15, 500, time.UTC)
+	st := &storetest.StubStore{
+		Countries: []store.Country{testCountry1},
+		Provinces: []store.Province{
+			store.Province{Country: testCountry1, Name: "Test Province", Slug: "test-province"},
+		},
+		LastIngest: lastIngest,
+	}
+	s := server.New(st)
+	handler := s.ConditionalMiddleware(http.HandlerFunc(s.GetProvinceTimeSeries))
+
+	// The request matches the tag of the data, but the province does not exist.
+	for _, ifNoneMatch := range []string{"", fmt.Sprintf(`"%x-json"`, lastIngest.UnixNano())} {
+		req, err := http.NewRequest(http.MethodGet, "/timeseries/test-country-1/atlantis/confirmed", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"countryslug": "test-country-1", "province": "atlantis", "status": store.Confirmed})
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		if expectedCode, got := http.StatusNotFound, res.Code; got != expectedCode {
+			t.Errorf("Wrong status code returned with If-None-Match %v: got %v want %v", ifNoneMatch, got, expectedCode)
+		}
+		for _, name := range []string{"ETag", "Last-Modified", "Cache-Control"} {
+			if got := res.Header().Get(name); got != "" {
+				t.Errorf("Wrong %s returned with If-None-Match %v: got %v want none", name, ifNoneMatch, got)
+			}
+		}
+		if res.Body.Len() == 0 {
+			t.Errorf("Wrong body returned with If-None-Match %v: got none want an error", ifNoneMatch)
+		}
+	}
+}
+
+func TestGetCacheStats(t *testing.T) {
+	st := &storetest.StubStore{
+		Countries: []store.Country{testCountry1},
+	}
+	cached := store.NewCachedService(st, store.CacheOptions{TTL: time.Hour, MaxEntries: 10})
+
+	for i := 0; i < 2; i++ {
+		if _, err := cached.GetCountries(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := server.New(cached)
+
+	req, err := http.NewRequest(http.MethodGet, "/status/cache", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.GetCacheStats)
+	handler.ServeHTTP(res, req)
+
+	// Test status code
+	if expectedCode, got := http.StatusOK, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+
+	// Test body
+	stats := store.CacheStats{}
+
+	err = json.Unmarshal(res.Body.Bytes(), &stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expectedStats := (store.CacheStats{Hits: 1, Misses: 1, Entries: 1}); stats != expectedStats {
+		t.Errorf("Wrong stats returned: got %+v want %+v", stats, expectedStats)
+	}
+}
+
+func TestGetCacheStatsWithoutCache(t *testing.T) {
+	server := server.New(&storetest.StubStore{})
+
+	req, err := http.NewRequest(http.MethodGet, "/status/cache", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.GetCacheStats)
+	handler.ServeHTTP(res, req)
+
+	if expectedCode, got := http.StatusNotFound, res.Code; got != expectedCode {
+		t.Errorf("Wrong status code returned: got %v want %v", got, expectedCode)
+	}
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jaaanko/covid-19-api/internal/store"
+	"github.com/jaaanko/covid-19-api/internal/webhooks"
+)
+
+const (
+	defaultDeliveries = 10
+	maxDeliveries     = 100
+)
+
+// maxSubscriptionBody is the largest request body accepted for a subscription, in bytes.
+const maxSubscriptionBody = 1 << 16
+
+// SetAPIKey sets the key that requests to the subscription routes must send in an
+// "Authorization: Bearer" header. The routes are not available until it is set.
+func (s *Server) SetAPIKey(key string) {
+	s.apiKey = key
+}
+
+// APIKeyMiddleware only runs next for requests that send the API key.
+func (s *Server) APIKeyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.apiKey == "" {
+			writeError(w, http.StatusServiceUnavailable, errors.New("Subscriptions are not available"))
+			return
+		}
+
+		key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(key), []byte(s.apiKey)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("Invalid API key. Please send it in an Authorization: Bearer header"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetSubscriptions lists the subscriptions without their secrets.
+func (s *Server) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs, err := s.store.GetSubscriptions()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	writeResponse(w, r, subs)
+}
+
+// CreateSubscription stores the subscription of the request body and responds with it. Its secret
+// is generated unless the body sets one, and is only ever returned in this response.
+func (s *Server) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	sub, err := decodeSubscription(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if sub.Secret == "" {
+		if sub.Secret, err = newSecret(); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if err := s.store.CreateSubscription(sub); err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/subscriptions/%d", sub.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+func (s *Server) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := subscriptionID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	sub, err := s.store.GetSubscription(id)
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+
+	sub.Secret = ""
+	writeResponse(w, r, sub)
+}
+
+// UpdateSubscription replaces a subscription with the request body. The secret is kept unless the body sets one.
+func (s *Server) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := subscriptionID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	sub, err := decodeSubscription(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	stored, err := s.store.GetSubscription(id)
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+
+	sub.ID = id
+	if sub.Secret == "" {
+		sub.Secret = stored.Secret
+	}
+
+	if err := s.store.UpdateSubscription(sub); err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+
+	sub.Secret = ""
+	writeResponse(w, r, sub)
+}
+
+func (s *Server) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := subscriptionID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.store.DeleteSubscription(id); err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDeliveries lists the latest delivery attempts of a subscription, newest first.
+func (s *Server) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := subscriptionID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	limit := defaultDeliveries
+
+	if param := r.URL.Query().Get("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > maxDeliveries {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid limit. Please use a number between 1 and %d", maxDeliveries))
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := s.store.GetDeliveries(id, limit)
+
+	if err != nil {
+		s.writeStoreError(w, err)
+	} else {
+		writeResponse(w, r, deliveries)
+	}
+}
+
+func subscriptionID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("Invalid subscription id. Please use an id from /subscriptions")
+	}
+	return id, nil
+}
+
+// decodeSubscription reads and validates the subscription of the request body.
+func decodeSubscription(w http.ResponseWriter, r *http.Request) (*store.Subscription, error) {
+	sub := &store.Subscription{}
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSubscriptionBody)).Decode(sub); err != nil {
+		return nil, errors.New("Invalid body. Please send a JSON object with url, countrySlug, metric, rule and threshold")
+	}
+
+	target, err := url.Parse(sub.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, errors.New("Invalid url. Please use an absolute http or https URL")
+	}
+
+	// Deliveries check the address they dial again, since the host may resolve differently by then.
+	if err := webhooks.CheckTarget(r.Context(), target.Hostname()); err != nil {
+		return nil, errors.New("Invalid url. Please use a URL on a public address")
+	}
+
+	if sub.CountrySlug == "" {
+		return nil, errors.New("Missing countrySlug. Please use a country slug from /list/countries")
+	}
+
+	if !isValidStatus(sub.Metric) {
+		return nil, errors.New("Invalid metric. Please select from the following: confirmed, recoveries, deaths")
+	}
+
+	if sub.Rule != store.AboveRule && sub.Rule != store.GrowthRule {
+		return nil, fmt.Errorf("Invalid rule. Please select from the following: %s, %s", store.AboveRule, store.GrowthRule)
+	}
+
+	return sub, nil
+}
+
+// newSecret returns a random secret to sign the deliveries of a subscription with.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,306 @@
+package store
+
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// CacheOptions bounds a CachedService.
+type CacheOptions struct {
+	// TTL is how long a result is served before the store is queried again.
+	TTL time.Duration
+	// MaxEntries is the number of results kept. The least recently used ones are evicted first.
+	MaxEntries int
+}
+
+// CacheStats counts the lookups of a CachedService since it was created. Hits were served from
+// the cache, Misses queried the store and Coalesced waited for an identical query of another caller.
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Coalesced int64 `json:"coalesced"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+}
+
+// CachedService memoizes the reads of the data of a Service, which only changes with an ingest, per
+// method and arguments. Concurrent identical reads share a single query. Errors are not cached, and
+// the other methods go straight to the Service.
+type CachedService struct {
+	Service
+	opts CacheOptions
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	calls   map[string]*cacheCall
+	stats   CacheStats
+}
+
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// cacheCall is a query in flight, which identical reads wait for.
+type cacheCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func NewCachedService(st Service, opts CacheOptions) *CachedService {
+	return &CachedService{
+		Service: st,
+		opts:    opts,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		calls:   make(map[string]*cacheCall),
+	}
+}
+
+// Invalidate drops every cached result. Reads in flight are not cached once they complete.
+func (c *CachedService) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.calls = make(map[string]*cacheCall)
+}
+
+func (c *CachedService) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// get returns a copy of the result cached under key, or of the result of load. Callers that ask for
+// the same key while it loads wait for the same result.
+func (c *CachedService) get(key string, load func() (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(element)
+			c.stats.Hits++
+			c.mu.Unlock()
+			return clone(entry.value), nil
+		}
+		c.lru.Remove(element)
+		delete(c.entries, key)
+	}
+
+	if call, ok := c.calls[key]; ok {
+		c.stats.Coalesced++
+		c.mu.Unlock()
+
+		<-call.done
+		if call.err != nil {
+			return nil, call.err
+		}
+		return clone(call.value), nil
+	}
+
+	call := &cacheCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	call.value, call.err = load()
+
+	c.mu.Lock()
+	// The call was dropped if the cache was invalidated while it ran.
+	if c.calls[key] == call {
+		delete(c.calls, key)
+		if call.err == nil {
+			c.add(key, call.value)
+		}
+	}
+	c.mu.Unlock()
+	close(call.done)
+
+	if call.err != nil {
+		return nil, call.err
+	}
+	return clone(call.value), nil
+}
+
+// add caches value under key, evicting the least recently used results beyond MaxEntries.
+func (c *CachedService) add(key string, value interface{}) {
+	if c.opts.MaxEntries <= 0 || c.opts.TTL <= 0 {
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, value: value, expires: time.Now().Add(c.opts.TTL)})
+
+	for c.lru.Len() > c.opts.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+// clone copies a cached slice, or the struct a cached pointer points to along with its slices,
+// so that callers can modify what they get without changing the cache, as the analytics package
+// does with time series. Values behind other pointers are shared.
+func clone(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+
+	switch {
+	case v.Kind() == reflect.Slice:
+		return cloneSlice(v).Interface()
+	case v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Struct:
+		copied := reflect.New(v.Elem().Type())
+		copied.Elem().Set(v.Elem())
+
+		for i := 0; i < copied.Elem().NumField(); i++ {
+			field := copied.Elem().Field(i)
+			if field.Kind() == reflect.Slice && field.CanSet() {
+				field.Set(cloneSlice(field))
+			}
+		}
+		return copied.Interface()
+	}
+
+	return value
+}
+
+func cloneSlice(v reflect.Value) reflect.Value {
+	if v.IsNil() {
+		return v
+	}
+
+	copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	reflect.Copy(copied, v)
+	return copied
+}
+
+func (c *CachedService) GetCountries() ([]Country, error) {
+	v, err := c.get("GetCountries", func() (interface{}, error) {
+		return c.Service.GetCountries()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]Country), nil
+}
+
+func (c *CachedService) GetGlobalStats(date time.Time) (*GlobalStats, error) {
+	v, err := c.get(fmt.Sprintf("GetGlobalStats %v", date), func() (interface{}, error) {
+		return c.Service.GetGlobalStats(date)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*GlobalStats), nil
+}
+
+func (c *CachedService) GetSummary(q SummaryQuery) (*Summary, error) {
+	v, err := c.get(fmt.Sprintf("GetSummary %+v", q), func() (interface{}, error) {
+		return c.Service.GetSummary(q)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Summary), nil
+}
+
+func (c *CachedService) GetProvinces(countrySlug string) ([]Province, error) {
+	v, err := c.get(fmt.Sprintf("GetProvinces %q", countrySlug), func() (interface{}, error) {
+		return c.Service.GetProvinces(countrySlug)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]Province), nil
+}
+
+func (c *CachedService) GetTimeSeries(countrySlug string, status string, q TimeSeriesQuery) (*TimeSeries, error) {
+	v, err := c.get(fmt.Sprintf("GetTimeSeries %q %q %+v", countrySlug, status, q), func() (interface{}, error) {
+		return c.Service.GetTimeSeries(countrySlug, status, q)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*TimeSeries), nil
+}
+
+func (c *CachedService) GetProvinceTimeSeries(countrySlug string, provinceSlug string, status string, q TimeSeriesQuery) (*TimeSeries, error) {
+	v, err := c.get(fmt.Sprintf("GetProvinceTimeSeries %q %q %q %+v", countrySlug, provinceSlug, status, q), func() (interface{}, error) {
+		return c.Service.GetProvinceTimeSeries(countrySlug, provinceSlug, status, q)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*TimeSeries), nil
+}
+
+func (c *CachedService) GetCounties(countrySlug string, provinceSlug string) ([]County, error) {
+	v, err := c.get(fmt.Sprintf("GetCounties %q %q", countrySlug, provinceSlug), func() (interface{}, error) {
+		return c.Service.GetCounties(countrySlug, provinceSlug)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]County), nil
+}
+
+func (c *CachedService) GetCountyTimeSeries(countrySlug string, provinceSlug string, countySlug string, status string, q TimeSeriesQuery) (*TimeSeries, error) {
+	v, err := c.get(fmt.Sprintf("GetCountyTimeSeries %q %q %q %q %+v", countrySlug, provinceSlug, countySlug, status, q), func() (interface{}, error) {
+		return c.Service.GetCountyTimeSeries(countrySlug, provinceSlug, countySlug, status, q)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*TimeSeries), nil
+}
+
+func (c *CachedService) GetAggTimeSeries(countrySlug string, status string, q TimeSeriesQuery) (*TimeSeries, error) {
+	v, err := c.get(fmt.Sprintf("GetAggTimeSeries %q %q %+v", countrySlug, status, q), func() (interface{}, error) {
+		return c.Service.GetAggTimeSeries(countrySlug, status, q)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*TimeSeries), nil
+}
+
+func (c *CachedService) GetComparison(countrySlugs []string, status string, q TimeSeriesQuery) (*Comparison, error) {
+	v, err := c.get(fmt.Sprintf("GetComparison %q %q %+v", countrySlugs, status, q), func() (interface{}, error) {
+		return c.Service.GetComparison(countrySlugs, status, q)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Comparison), nil
+}
+
+func (c *CachedService) GetRegionTimeSeries(region string, status string, q TimeSeriesQuery) (*TimeSeries, error) {
+	v, err := c.get(fmt.Sprintf("GetRegionTimeSeries %q %q %+v", region, status, q), func() (interface{}, error) {
+		return c.Service.GetRegionTimeSeries(region, status, q)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*TimeSeries), nil
+}
+
+func (c *CachedService) GetLastIngest() (time.Time, error) {
+	v, err := c.get("GetLastIngest", func() (interface{}, error) {
+		return c.Service.GetLastIngest()
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return v.(time.Time), nil
+}
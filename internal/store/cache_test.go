@@ -0,0 +1,178 @@
+package store
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingService counts the GetCountries queries, which block until release is closed.
+type blockingService struct {
+	Service
+	queries int32
+	release chan struct{}
+}
+
+func (s *blockingService) GetCountries() ([]Country, error) {
+	atomic.AddInt32(&s.queries, 1)
+	<-s.release
+	return s.Service.GetCountries()
+}
+
+func TestCachedService(t *testing.T) {
+	st := newTestStore(t)
+	cached := NewCachedService(st, CacheOptions{TTL: time.Hour, MaxEntries: 10})
+
+	// The collector writes through the cache with the dialect of the store.
+	ingest(t, cached, testSource())
+
+	for i := 0; i < 2; i++ {
+		if _, err := cached.GetSummary(SummaryQuery{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats := cached.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("Stats() = %+v; want 1 hit, 1 miss and 1 entry", stats)
+	}
+
+	// Callers can modify what they get.
+	ts, err := cached.GetAggTimeSeries("france", Confirmed, TimeSeriesQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.DataPoints[0].Amount = 1000
+
+	ts, err = cached.GetAggTimeSeries("france", Confirmed, TimeSeriesQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ts.DataPoints[0].Amount, int64(2); got != want {
+		t.Errorf("cached Amount = %d; want %d", got, want)
+	}
+
+	// Errors are not cached.
+	for i := 0; i < 2; i++ {
+		if _, err := cached.GetAggTimeSeries("atlantis", Confirmed, TimeSeriesQuery{}); err == nil {
+			t.Fatalf("GetAggTimeSeries() of an unknown country returned no error")
+		}
+	}
+
+	if got, want := cached.Stats().Misses, int64(4); got != want {
+		t.Errorf("Misses = %d; want %d", got, want)
+	}
+
+	cached.Invalidate()
+
+	if got := cached.Stats().Entries; got != 0 {
+		t.Errorf("Entries after Invalidate() = %d; want 0", got)
+	}
+}
+
+func TestCachedServiceInvalidatedByIngest(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	cached := NewCachedService(st, CacheOptions{TTL: time.Hour, MaxEntries: 10})
+
+	before, err := cached.GetGlobalStats(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := testSource()
+	src[ConfirmedGlobalSeries] = []byte(strings.Replace(testConfirmed, ",Italy,41.87,12.57,0,1,5", ",Italy,41.87,12.57,0,1,8", 1))
+
+	collector, err := NewJhuCsseDataCollector(cached, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector.OnIngest(func(report *IngestReport) {
+		cached.Invalidate()
+	})
+
+	if _, err := collector.UpdateConfirmedAndDeaths(); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := cached.GetGlobalStats(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if before.Confirmed == after.Confirmed {
+		t.Errorf("GetGlobalStats() still returns %d confirmed cases after the ingest", after.Confirmed)
+	}
+}
+
+func TestCachedServiceBounds(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	cached := NewCachedService(st, CacheOptions{TTL: time.Hour, MaxEntries: 1})
+
+	for _, slug := range []string{"france", "italy", "france"} {
+		if _, err := cached.GetProvinces(slug); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats := cached.Stats(); stats.Hits != 0 || stats.Evictions != 2 || stats.Entries != 1 {
+		t.Errorf("Stats() = %+v; want 0 hits, 2 evictions and 1 entry", stats)
+	}
+
+	expiring := NewCachedService(st, CacheOptions{TTL: time.Nanosecond, MaxEntries: 10})
+
+	for i := 0; i < 2; i++ {
+		if _, err := expiring.GetCountries(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats := expiring.Stats(); stats.Hits != 0 || stats.Misses != 2 {
+		t.Errorf("Stats() with an expired entry = %+v; want 0 hits and 2 misses", stats)
+	}
+}
+
+func TestCachedServiceCoalesces(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	blocking := &blockingService{Service: st, release: make(chan struct{})}
+	cached := NewCachedService(blocking, CacheOptions{TTL: time.Hour, MaxEntries: 10})
+
+	const callers = 5
+
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cached.GetCountries(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	// Wait for every caller to either query the store or wait for the query.
+	for {
+		stats := cached.Stats()
+		if stats.Misses+stats.Coalesced == callers {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(blocking.release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&blocking.queries); got != 1 {
+		t.Errorf("store queried %d times; want 1", got)
+	}
+
+	if stats := cached.Stats(); stats.Misses != 1 || stats.Coalesced != callers-1 {
+		t.Errorf("Stats() = %+v; want 1 miss and %d coalesced", stats, callers-1)
+	}
+}
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dailyCountrySummaryTable holds the totals of every country per date, which the collector keeps
+// in step with the tables it ingests so that summaries read a row per country instead of adding up
+// every location. A column is NULL when its source has no data for the country on that date.
+const dailyCountrySummaryTable = "daily_country_summary"
+
+// summarySource is an ingested table that fills in columns of daily_country_summary. Its query selects
+// the country name, the date and the totals of columns of a country between two dates.
+type summarySource struct {
+	query   string
+	columns []string
+	// names is set if the country names of the source replace those of the summary.
+	names bool
+}
+
+var (
+	confirmedAndDeathsSummary = summarySource{
+		query: `
+		select MAX(country), date_recorded, SUM(confirmed_cases), SUM(new_confirmed), SUM(deaths), SUM(new_deaths)
+		from confirmed_and_deaths_time_series
+		where country_slug = ? and county = '' and date_recorded between ? and ?
+		group by date_recorded
+		`,
+		columns: []string{"confirmed_cases", "new_confirmed", "deaths", "new_deaths"},
+		names:   true,
+	}
+
+	recoveriesSummary = summarySource{
+		query: `
+		select MAX(country), date_recorded, SUM(recoveries), SUM(new_recoveries)
+		from recoveries_time_series
+		where country_slug = ? and county = '' and date_recorded between ? and ?
+		group by date_recorded
+		`,
+		columns: []string{"recoveries", "new_recoveries"},
+		names:   true,
+	}
+
+	// The daily reports name some countries differently over time, such as Mainland China.
+	dailyReportsSummary = summarySource{
+		query: `
+		select MAX(country), date_reported, SUM(active)
+		from daily_reports
+		where country_slug = ? and date_reported between ? and ?
+		group by date_reported
+		`,
+		columns: []string{"active"},
+	}
+)
+
+// summaryRefresh collects the dates written per country by an ingest transaction, whose rows of
+// daily_country_summary are refreshed before it commits.
+type summaryRefresh map[string]*dateRange
+
+type dateRange struct {
+	from time.Time
+	to   time.Time
+}
+
+func (r summaryRefresh) add(countrySlug string, date time.Time) {
+	dates, ok := r[countrySlug]
+	if !ok {
+		r[countrySlug] = &dateRange{from: date, to: date}
+		return
+	}
+
+	if date.Before(dates.from) {
+		dates.from = date
+	}
+	if date.After(dates.to) {
+		dates.to = date
+	}
+}
+
+// summaryRow is the totals of source for a country on a date.
+type summaryRow struct {
+	country string
+	date    time.Time
+	values  []interface{}
+}
+
+// apply recomputes the columns of source in the rows of daily_country_summary of the collected dates.
+// A source only writes its own columns, so that the updates of different series do not overwrite each
+// other's totals.
+func (r summaryRefresh) apply(tx *sql.Tx, dialect dialect, source summarySource) error {
+	if len(r) == 0 {
+		return nil
+	}
+
+	cleared := make([]string, len(source.columns))
+	for i, column := range source.columns {
+		cleared[i] = column + " = NULL"
+	}
+
+	clear := fmt.Sprintf("UPDATE %s SET %s WHERE country_slug = ? AND date_recorded BETWEEN ? AND ?",
+		dailyCountrySummaryTable, strings.Join(cleared, ", "))
+
+	update := source.columns
+	if source.names {
+		update = append([]string{"country"}, source.columns...)
+	}
+
+	stmt, err := tx.Prepare(dialect.upsert(
+		dailyCountrySummaryTable,
+		append([]string{"country", "country_slug", "date_recorded"}, source.columns...),
+		[]string{"country_slug", "date_recorded"},
+		update,
+	))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	// Countries are refreshed in the same order by every transaction, so that concurrent updates of
+	// different series wait for each other's rows instead of deadlocking.
+	countrySlugs := make([]string, 0, len(r))
+	for countrySlug := range r {
+		countrySlugs = append(countrySlugs, countrySlug)
+	}
+	sort.Strings(countrySlugs)
+
+	for _, countrySlug := range countrySlugs {
+		dates := r[countrySlug]
+
+		if _, err := tx.Exec(clear, countrySlug, dates.from, dates.to); err != nil {
+			return err
+		}
+
+		rows, err := source.totals(tx, countrySlug, dates)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if _, err := stmt.Exec(append([]interface{}{row.country, countrySlug, row.date}, row.values...)...); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// totals reads the totals of source for countrySlug on dates. They are read in full before they are
+// written, since the MySQL driver cannot run a statement while the rows of another are open.
+func (source summarySource) totals(tx *sql.Tx, countrySlug string, dates *dateRange) ([]summaryRow, error) {
+	rows, err := tx.Query(source.query, countrySlug, dates.from, dates.to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := []summaryRow{}
+
+	for rows.Next() {
+		row := summaryRow{values: make([]interface{}, len(source.columns))}
+
+		dest := []interface{}{&row.country, scanTime{&row.date}}
+		for i := range row.values {
+			value := new(sql.NullInt64)
+			row.values[i] = value
+			dest = append(dest, value)
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		totals = append(totals, row)
+	}
+
+	return totals, rows.Err()
+}
+
+// refreshCountrySummary recomputes every row of daily_country_summary of countrySlug from all the sources.
+func refreshCountrySummary(tx *sql.Tx, dialect dialect, countrySlug string) error {
+	var from, to time.Time
+
+	err := tx.QueryRow(`
+	select MIN(date_recorded), MAX(date_recorded) from (
+		select date_recorded from confirmed_and_deaths_time_series where country_slug = ?
+		union all
+		select date_recorded from recoveries_time_series where country_slug = ?
+	) d
+	`, countrySlug, countrySlug).Scan(scanTime{&from}, scanTime{&to})
+	if err != nil || from.IsZero() {
+		return err
+	}
+
+	refresh := summaryRefresh{countrySlug: {from: from, to: to}}
+
+	for _, source := range []summarySource{confirmedAndDeathsSummary, recoveriesSummary, dailyReportsSummary} {
+		if err := refresh.apply(tx, dialect, source); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
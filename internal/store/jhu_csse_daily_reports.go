@@ -0,0 +1,308 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// firstDailyReport is the date of the first daily report published by JHU CSSE.
+var firstDailyReport = time.Date(2020, 1, 22, 0, 0, 0, 0, time.UTC)
+
+// maxDailyReportGap is the number of days in a row without a daily report after which no later report
+// is looked for. Days missing before a later report are skipped, since JHU CSSE left a few gaps.
+const maxDailyReportGap = 7
+
+// dailyReportRow is one location of a JHU CSSE daily report.
+type dailyReportRow struct {
+	Province          string
+	Country           string
+	County            string
+	LastUpdate        sql.NullTime
+	Confirmed         int64
+	Deaths            int64
+	Recovered         sql.NullInt64
+	Active            sql.NullInt64
+	IncidenceRate     sql.NullFloat64
+	CaseFatalityRatio sql.NullFloat64
+}
+
+func (row dailyReportRow) key() locationKey {
+	return locationKey{row.Province, row.Country, row.County}
+}
+
+// dailyReportColumns lists the names a column of the daily reports had over time, since JHU CSSE
+// renamed most of them in March 2020.
+var dailyReportColumns = map[string][]string{
+	"province":          {"Province_State", "Province/State"},
+	"country":           {"Country_Region", "Country/Region"},
+	"county":            {"Admin2"},
+	"lastUpdate":        {"Last_Update", "Last Update"},
+	"confirmed":         {"Confirmed"},
+	"deaths":            {"Deaths"},
+	"recovered":         {"Recovered"},
+	"active":            {"Active"},
+	"incidenceRate":     {"Incident_Rate", "Incidence_Rate"},
+	"caseFatalityRatio": {"Case_Fatality_Ratio", "Case-Fatality_Ratio"},
+}
+
+// lastUpdateLayouts are the formats of Last_Update found in the daily reports.
+var lastUpdateLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"1/2/2006 15:04",
+	"1/2/06 15:04",
+	"1/2/2006 15:04:05",
+}
+
+// UpdateDailyReports ingests the daily reports published since the latest one already stored,
+// which is read again since JHU CSSE revises recent reports, until maxDailyReportGap days in a row
+// have no report. Every report is committed on its own, so that an update that fails resumes from
+// the latest report it stored.
+func (jhu jhuCsseDataCollector) UpdateDailyReports() (*IngestReport, error) {
+	return jhu.record(DailyReportsRun, jhu.updateDailyReports)
+}
+
+func (jhu jhuCsseDataCollector) updateDailyReports(report *IngestReport) error {
+	var latest time.Time
+
+	err := jhu.db.QueryRow(`select MAX(date_reported) from daily_reports`).Scan(scanTime{&latest})
+	if err != nil {
+		return err
+	}
+
+	// Rows of dates up to the latest stored one are updates.
+	var stored *storedSeries
+	date := firstDailyReport
+
+	if !latest.IsZero() {
+		stored = &storedSeries{latest: latest}
+		date = latest
+	}
+
+	countryAliases, err := loadAliases(jhu.db)
+	if err != nil {
+		return err
+	}
+
+	var dates []time.Time
+
+	// missing holds the days without a report since the latest one read, which are skipped once a
+	// later report is found.
+	var missing, skipped []time.Time
+
+	for ; !date.After(time.Now().UTC()) && len(missing) < maxDailyReportGap; date = date.AddDate(0, 0, 1) {
+		rows, err := jhu.readDailyReport(date)
+		if errors.Is(err, os.ErrNotExist) {
+			missing = append(missing, date)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		skipped = append(skipped, missing...)
+		missing = nil
+
+		report.RowsRead += len(rows)
+
+		if err := jhu.writeDailyReport(report, date, rows, countryAliases, stored); err != nil {
+			return err
+		}
+
+		dates = append(dates, date)
+	}
+
+	report.cover(dates)
+
+	for _, date := range skipped {
+		log.Printf("Skipped missing daily report %s\n", DailyReport(date))
+	}
+
+	log.Printf("Done updating daily reports (%d reports read, %d rows inserted, %d rows updated)\n", len(dates), report.RowsInserted, report.RowsUpdated)
+	return nil
+}
+
+// writeDailyReport upserts the rows of the daily report of date in one transaction. Locations that
+// appear more than once in the report are ambiguous, so they are skipped and recorded in report.
+func (jhu jhuCsseDataCollector) writeDailyReport(report *IngestReport, date time.Time, rows []dailyReportRow, countryAliases aliases, stored *storedSeries) error {
+	name := DailyReport(date)
+
+	count := make(map[locationKey]int, len(rows))
+	for _, row := range rows {
+		count[row.key()]++
+	}
+
+	tx, err := jhu.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(jhu.dialect.upsert(
+		"daily_reports",
+		[]string{"country", "country_slug", "province", "county", "date_reported", "last_update", "confirmed", "deaths",
+			"recovered", "active", "incidence_rate", "case_fatality_ratio"},
+		[]string{"country_slug", "province", "county", "date_reported"},
+		[]string{"country", "last_update", "confirmed", "deaths", "recovered", "active", "incidence_rate", "case_fatality_ratio"},
+	))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	refresh := summaryRefresh{}
+
+	for _, row := range rows {
+		key := row.key()
+
+		if n := count[key]; n != 1 {
+			if n > 1 {
+				report.unmatched(key, name, "duplicate location")
+				count[key] = 0
+			}
+			continue
+		}
+
+		countrySlug := countryAliases.canonical(generateCountrySlug(row.Country))
+
+		_, err := stmt.Exec(row.Country, countrySlug, row.Province, row.County, date, row.LastUpdate, row.Confirmed, row.Deaths,
+			row.Recovered, row.Active, row.IncidenceRate, row.CaseFatalityRatio)
+		if err != nil {
+			return err
+		}
+
+		report.written(countrySlug, stored, date)
+		refresh.add(countrySlug, date)
+	}
+
+	if err := refresh.apply(tx, jhu.dialect, dailyReportsSummary); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// readDailyReport opens and parses the daily report of date from the collector's source.
+func (jhu jhuCsseDataCollector) readDailyReport(date time.Time) ([]dailyReportRow, error) {
+	body, _, err := jhu.src.Open(DailyReport(date))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return parseDailyReport(body)
+}
+
+// parseDailyReport parses a JHU CSSE daily report, whose columns are looked up by name since they
+// changed over time. Values missing from a report, or from a row, are left null.
+func parseDailyReport(r io.Reader) ([]dailyReportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	column := make(map[string]int)
+	for field, names := range dailyReportColumns {
+		for _, name := range names {
+			for i, header := range headers {
+				if strings.TrimSpace(strings.TrimPrefix(header, "\ufeff")) == name {
+					column[field] = i
+				}
+			}
+		}
+	}
+
+	for _, field := range []string{"province", "country", "confirmed", "deaths"} {
+		if _, ok := column[field]; !ok {
+			return nil, fmt.Errorf("unexpected daily report header: missing %s in %v", dailyReportColumns[field][0], headers)
+		}
+	}
+
+	rows := []dailyReportRow{}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		value := func(field string) string {
+			if i, ok := column[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := dailyReportRow{
+			Province: value("province"),
+			Country:  value("country"),
+			County:   value("county"),
+		}
+
+		for _, layout := range lastUpdateLayouts {
+			if t, err := time.Parse(layout, value("lastUpdate")); err == nil {
+				row.LastUpdate = sql.NullTime{Time: t, Valid: true}
+				break
+			}
+		}
+
+		var confirmed, deaths sql.NullInt64
+
+		for field, dest := range map[string]*sql.NullInt64{
+			"confirmed": &confirmed,
+			"deaths":    &deaths,
+			"recovered": &row.Recovered,
+			"active":    &row.Active,
+		} {
+			if *dest, err = parseCount(value(field)); err != nil {
+				return nil, err
+			}
+		}
+
+		row.Confirmed = confirmed.Int64
+		row.Deaths = deaths.Int64
+
+		for field, dest := range map[string]*sql.NullFloat64{
+			"incidenceRate":     &row.IncidenceRate,
+			"caseFatalityRatio": &row.CaseFatalityRatio,
+		} {
+			if v := value(field); v != "" {
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return nil, err
+				}
+				*dest = sql.NullFloat64{Float64: f, Valid: true}
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// parseCount parses a count of a daily report, which some reports write with a decimal point.
+func parseCount(s string) (sql.NullInt64, error) {
+	if s == "" {
+		return sql.NullInt64{}, nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+
+	return sql.NullInt64{Int64: int64(f), Valid: true}, nil
+}
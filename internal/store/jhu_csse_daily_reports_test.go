@@ -0,0 +1,55 @@
+package store
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDailyReport(t *testing.T) {
+	input := "\ufeffProvince/State,Country/Region,Last Update,Confirmed,Deaths,Recovered\n" +
+		"Hubei,Mainland China,1/22/2020 17:00,444,,28\n"
+
+	rows, err := parseDailyReport(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(rows), 1; got != want {
+		t.Fatalf("len(rows) = %d; want %d", got, want)
+	}
+
+	row := rows[0]
+	if row.Province != "Hubei" || row.Country != "Mainland China" || row.Confirmed != 444 || row.Deaths != 0 {
+		t.Errorf("rows[0] = %+v; want Hubei, Mainland China with 444 confirmed cases", row)
+	}
+
+	if !row.LastUpdate.Valid || !row.LastUpdate.Time.Equal(time.Date(2020, 1, 22, 17, 0, 0, 0, time.UTC)) {
+		t.Errorf("rows[0].LastUpdate = %v; want 2020-01-22 17:00", row.LastUpdate)
+	}
+
+	if row.Active.Valid || row.IncidenceRate.Valid {
+		t.Errorf("rows[0] has Active %v and IncidenceRate %v; want both null", row.Active, row.IncidenceRate)
+	}
+
+	input = "FIPS,Admin2,Province_State,Country_Region,Last_Update,Lat,Long_,Confirmed,Deaths,Recovered,Active,Combined_Key,Incident_Rate,Case_Fatality_Ratio\n" +
+		"36061,New York,New York,US,2021-01-01 05:22:33,40.77,-73.97,200000.0,20000,,180000,\"New York City, New York, US\",2399.0,10.0\n"
+
+	rows, err = parseDailyReport(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row = rows[0]
+	if row.County != "New York" || row.Confirmed != 200000 || !row.Active.Valid || row.Active.Int64 != 180000 {
+		t.Errorf("rows[0] = %+v; want New York county with 200000 confirmed and 180000 active cases", row)
+	}
+
+	if !row.IncidenceRate.Valid || row.IncidenceRate.Float64 != 2399 || !row.CaseFatalityRatio.Valid || row.CaseFatalityRatio.Float64 != 10 {
+		t.Errorf("rows[0] has IncidenceRate %v and CaseFatalityRatio %v; want 2399 and 10", row.IncidenceRate, row.CaseFatalityRatio)
+	}
+
+	if row.Recovered.Valid {
+		t.Errorf("rows[0].Recovered = %v; want null", row.Recovered)
+	}
+}
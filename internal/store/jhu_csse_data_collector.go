@@ -2,60 +2,253 @@ package store
 
 import (
 	"database/sql"
+	"encoding/binary"
 	"encoding/csv"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
-	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
-const baseUrl = "https://raw.githubusercontent.com/CSSEGISandData/COVID-19/master/csse_covid_19_data/csse_covid_19_time_series/"
+type jhuCsseDataCollector struct {
+	db      *sql.DB
+	dialect dialect
+	src     Source
+	hooks   []func(report *IngestReport)
+}
 
-var (
-	confirmedSrc  = fmt.Sprintf("%stime_series_covid19_confirmed_global.csv", baseUrl)
-	deathsSrc     = fmt.Sprintf("%stime_series_covid19_deaths_global.csv", baseUrl)
-	recoveriesSrc = fmt.Sprintf("%stime_series_covid19_recovered_global.csv", baseUrl)
-)
+func NewJhuCsseDataCollector(st Service, src Source) (jhuCsseDataCollector, error) {
+	db, err := st.GetDbInstance()
+	if err != nil {
+		return jhuCsseDataCollector{}, err
+	}
 
-type jhuCsseDataCollector struct {
-	db *sql.DB
+	return jhuCsseDataCollector{db: db, dialect: dialectOf(st), src: src}, nil
+}
+
+// seriesRow is one location of a JHU CSSE time series CSV. Only the US series have a County,
+// along with its FIPS code and Population when they are known.
+type seriesRow struct {
+	Province   string
+	Country    string
+	County     string
+	FIPS       string
+	Population int64
+	Latitude   float64
+	Longitude  float64
+	Values     []int
+}
+
+// seriesTable is a parsed JHU CSSE time series CSV.
+type seriesTable struct {
+	Dates []time.Time
+	Rows  []seriesRow
+}
+
+// locationKey identifies a row of a JHU CSSE time series CSV.
+type locationKey struct {
+	Province string
+	Country  string
+	County   string
+}
+
+func (row seriesRow) key() locationKey {
+	return locationKey{row.Province, row.Country, row.County}
+}
+
+// IngestReport describes what a collector update read and wrote.
+type IngestReport struct {
+	IngestRun
+	Unmatched []UnmatchedLocation `json:"unmatched,omitempty"`
+	// Countries are the slugs of the countries with rows inserted or updated, in the order written.
+	Countries []string `json:"countries,omitempty"`
+
+	changed map[string]bool
+}
+
+// UnmatchedLocation is a CSV row that was skipped because it could not be joined
+// with the other series of an update, or because its location appears more than once.
+type UnmatchedLocation struct {
+	Province string `json:"province"`
+	Country  string `json:"country"`
+	County   string `json:"county,omitempty"`
+	Series   string `json:"series"`
+	Reason   string `json:"reason"`
+}
+
+// storedKey identifies a location in the time series tables.
+type storedKey struct {
+	CountrySlug string
+	Province    string
+	County      string
+}
+
+// storedSeries summarizes what the database already holds for a location. checksum is that of the
+// values written by the latest ingest of the location, and is empty if none recorded one yet.
+type storedSeries struct {
+	latest   time.Time
+	count    int
+	sums     []int64
+	checksum string
 }
 
-func NewJhuCsseDataCollector(db *sql.DB) (jhuCsseDataCollector, error) {
-	return jhuCsseDataCollector{db}, db.Ping()
+func (jhu jhuCsseDataCollector) UpdateConfirmedAndDeaths() (*IngestReport, error) {
+	return jhu.record(ConfirmedAndDeathsRun, jhu.updateConfirmedAndDeaths)
 }
 
-func (jhu jhuCsseDataCollector) UpdateConfirmedAndDeaths() error {
-	confirmedResponse, err := http.Get(confirmedSrc)
+func (jhu jhuCsseDataCollector) UpdateRecoveries() (*IngestReport, error) {
+	return jhu.record(RecoveriesRun, jhu.updateRecoveries)
+}
+
+// UpdateUSCounties ingests the confirmed cases and deaths of each US county, which JHU CSSE publishes
+// apart from the global series, along with the FIPS code and population of the counties.
+func (jhu jhuCsseDataCollector) UpdateUSCounties() (*IngestReport, error) {
+	return jhu.record(USCountiesRun, jhu.updateUSCounties)
+}
+
+// OnIngest registers hook to be called with the report of every update that succeeded, once its
+// rows are committed. Hooks must be registered before the updates start.
+func (jhu *jhuCsseDataCollector) OnIngest(hook func(report *IngestReport)) {
+	jhu.hooks = append(jhu.hooks, hook)
+}
+
+// record runs update and stores the outcome in ingest_runs, whether or not the update succeeded.
+func (jhu jhuCsseDataCollector) record(series string, update func(report *IngestReport) error) (*IngestReport, error) {
+	report := &IngestReport{IngestRun: IngestRun{Series: series, Source: jhu.src.String(), StartedAt: time.Now().UTC()}}
+
+	err := update(report)
+
+	report.FinishedAt = time.Now().UTC()
+	if err != nil {
+		report.Error = err.Error()
+	}
+	report.RowsSkipped = len(report.Unmatched)
+
+	_, recordErr := jhu.db.Exec(`INSERT INTO ingest_runs
+	(series,source,started_at,finished_at,rows_read,rows_inserted,rows_updated,rows_skipped,first_date,last_date,error)
+	VALUES (?,?,?,?,?,?,?,?,?,?,?)
+	`, report.Series, report.Source, report.StartedAt, report.FinishedAt, report.RowsRead, report.RowsInserted,
+		report.RowsUpdated, report.RowsSkipped, report.FirstDate, report.LastDate, nullString(report.Error))
+
+	if recordErr != nil {
+		log.Println("could not record ingest run:", recordErr)
+	}
+
+	if err != nil {
+		return report, err
+	}
+
+	for _, hook := range jhu.hooks {
+		hook(report)
+	}
+	return report, nil
+}
+
+func (jhu jhuCsseDataCollector) updateConfirmedAndDeaths(report *IngestReport) error {
+	confirmed, err := jhu.readSeries(ConfirmedGlobalSeries, parseSeries)
 	if err != nil {
 		return err
 	}
-	defer confirmedResponse.Body.Close()
 
-	deathsResponse, err := http.Get(deathsSrc)
+	deaths, err := jhu.readSeries(DeathsGlobalSeries, parseSeries)
 	if err != nil {
 		return err
 	}
-	defer deathsResponse.Body.Close()
 
-	confirmedReader := csv.NewReader(confirmedResponse.Body)
-	deathsReader := csv.NewReader(deathsResponse.Body)
+	report.RowsRead = len(confirmed.Rows) + len(deaths.Rows)
 
-	headers, err := confirmedReader.Read()
+	err = jhu.writeConfirmedAndDeaths(report, confirmed, deaths, ConfirmedGlobalSeries, DeathsGlobalSeries, confirmedAndDeathsTable)
 	if err != nil {
 		return err
 	}
 
-	_, err = deathsReader.Read()
+	log.Printf("Done updating confirmed and deaths (%d rows inserted, %d rows updated, %d locations unmatched)\n", report.RowsInserted, report.RowsUpdated, len(report.Unmatched))
+	return nil
+}
+
+func (jhu jhuCsseDataCollector) updateUSCounties(report *IngestReport) error {
+	confirmed, err := jhu.readSeries(ConfirmedUSSeries, parseUSSeries)
+	if err != nil {
+		return err
+	}
+
+	deaths, err := jhu.readSeries(DeathsUSSeries, parseUSSeries)
+	if err != nil {
+		return err
+	}
+
+	report.RowsRead = len(confirmed.Rows) + len(deaths.Rows)
+
+	// Rows without a county are the totals of territories, which the global series already cover.
+	confirmed.Rows = confirmed.withCounties(ConfirmedUSSeries, report)
+	deaths.Rows = deaths.withCounties(DeathsUSSeries, report)
+
+	// Only the deaths series reports the population of the counties.
+	if err := jhu.saveCounties(deaths); err != nil {
+		return err
+	}
+
+	// The latest date of the global series is left as is, since the summaries do not include counties.
+	if err := jhu.writeConfirmedAndDeaths(report, confirmed, deaths, ConfirmedUSSeries, DeathsUSSeries, ""); err != nil {
+		return err
+	}
+
+	log.Printf("Done updating US counties (%d rows inserted, %d rows updated, %d locations unmatched)\n", report.RowsInserted, report.RowsUpdated, len(report.Unmatched))
+	return nil
+}
+
+// writeConfirmedAndDeaths writes the locations found in both the confirmed and deaths series to the
+// confirmed and deaths table, and records the last date of the series as its latest date unless latest is empty.
+func (jhu jhuCsseDataCollector) writeConfirmedAndDeaths(report *IngestReport, confirmed *seriesTable, deaths *seriesTable, confirmedName string, deathsName string, latest string) error {
+	if len(confirmed.Dates) != len(deaths.Dates) {
+		return fmt.Errorf("confirmed and deaths series cover different dates: %d and %d columns", len(confirmed.Dates), len(deaths.Dates))
+	}
+
+	report.cover(confirmed.Dates)
+
+	confirmedRows := confirmed.index(confirmedName, report)
+	deathsRows := deaths.index(deathsName, report)
+
+	for _, row := range confirmed.Rows {
+		key := row.key()
+		if _, ok := confirmedRows[key]; ok {
+			if _, ok := deathsRows[key]; !ok {
+				report.unmatched(key, confirmedName, "missing from "+deathsName)
+			}
+		}
+	}
+
+	for _, row := range deaths.Rows {
+		key := row.key()
+		if _, ok := deathsRows[key]; ok {
+			if _, ok := confirmedRows[key]; !ok {
+				report.unmatched(key, deathsName, "missing from "+confirmedName)
+			}
+		}
+	}
+
+	countryAliases, err := loadAliases(jhu.db)
+	if err != nil {
+		return err
+	}
+
+	stored, err := jhu.loadStoredSeries(`
+	select s.country_slug, s.province, s.county, s.latest, s.dates, c.confirmed_and_deaths, s.confirmed, s.deaths
+	from (
+		select country_slug, province, county, MAX(date_recorded) latest, COUNT(*) dates, SUM(confirmed_cases) confirmed, SUM(deaths) deaths
+		from confirmed_and_deaths_time_series group by country_slug, province, county
+	) s
+	left join series_checksums c on c.country_slug = s.country_slug and c.province = s.province and c.county = s.county
+	`)
 	if err != nil {
 		return err
 	}
 
-	dates := headers[4:]
+	dates := confirmed.Dates
 
 	tx, err := jhu.db.Begin()
 	if err != nil {
@@ -63,97 +256,154 @@ func (jhu jhuCsseDataCollector) UpdateConfirmedAndDeaths() error {
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(`INSERT INTO confirmed_and_deaths_time_series 
-	(province,country,country_slug,latitude,longitude,confirmed_cases,new_confirmed,deaths,new_deaths,date_recorded) 
-	VALUES (?,?,?,?,?,?,?,?,?,?)
-	ON DUPLICATE KEY UPDATE confirmed_cases = VALUES(confirmed_cases), new_confirmed = VALUES(new_confirmed),deaths = VALUES(deaths), new_deaths = VALUES(new_deaths)
-	`)
+	stmt, err := tx.Prepare(jhu.dialect.upsert(
+		confirmedAndDeathsTable,
+		[]string{"province", "county", "country", "country_slug", "latitude", "longitude", "confirmed_cases", "new_confirmed", "deaths", "new_deaths", "date_recorded"},
+		[]string{"country_slug", "province", "county", "date_recorded"},
+		[]string{"confirmed_cases", "new_confirmed", "deaths", "new_deaths"},
+	))
 
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	for {
-		prevConfirmed := 0
-		prevDeaths := 0
+	checksums, err := jhu.saveChecksum(tx, "confirmed_and_deaths")
+	if err != nil {
+		return err
+	}
+	defer checksums.Close()
 
-		confirmedRow, err := confirmedReader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return err
-		}
+	refresh := summaryRefresh{}
 
-		deathsRow, err := deathsReader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return err
-		}
+	for _, confirmedRow := range confirmed.Rows {
+		key := confirmedRow.key()
 
-		lat, err := parseFloatWithCheck(confirmedRow[2], 64)
-		if err != nil {
-			return err
+		if _, ok := confirmedRows[key]; !ok {
+			continue
+		}
+		deathsRow, ok := deathsRows[key]
+		if !ok {
+			continue
 		}
 
-		long, err := parseFloatWithCheck(confirmedRow[3], 64)
-		if err != nil {
-			return err
+		countrySlug := countryAliases.canonical(generateCountrySlug(confirmedRow.Country))
+
+		s := stored[storedKey{countrySlug, confirmedRow.Province, confirmedRow.County}]
+		start := s.pending(dates, confirmedRow.Values, deathsRow.Values)
+
+		prevConfirmed := 0
+		prevDeaths := 0
+		if start > 0 {
+			prevConfirmed = confirmedRow.Values[start-1]
+			prevDeaths = deathsRow.Values[start-1]
 		}
 
-		for j := 0; j < len(dates); j++ {
-			deaths, err := strconv.Atoi(deathsRow[j+4])
-			if err != nil {
-				return err
-			}
+		for j := start; j < len(dates); j++ {
+			confirmed := confirmedRow.Values[j]
+			deaths := deathsRow.Values[j]
 
-			confirmed, err := strconv.Atoi(confirmedRow[j+4])
-			if err != nil {
-				return err
-			}
+			_, err = stmt.Exec(confirmedRow.Province, confirmedRow.County, confirmedRow.Country, countrySlug, confirmedRow.Latitude, confirmedRow.Longitude,
+				confirmed, max(0, confirmed-prevConfirmed), deaths, max(0, deaths-prevDeaths), dates[j])
 
-			date, err := time.Parse("1/2/06", dates[j])
 			if err != nil {
 				return err
 			}
 
-			_, err = stmt.Exec(confirmedRow[0], confirmedRow[1], generateCountrySlug(confirmedRow[1]), lat, long, confirmed,
-				max(0, confirmed-prevConfirmed), deaths, max(0, deaths-prevDeaths), date)
+			prevConfirmed = confirmed
+			prevDeaths = deaths
+			report.written(countrySlug, s, dates[j])
 
+			if confirmedRow.County == "" {
+				refresh.add(countrySlug, dates[j])
+			}
+		}
+
+		if start < len(dates) {
+			_, err := checksums.Exec(countrySlug, confirmedRow.Province, confirmedRow.County, checksum(len(dates), confirmedRow.Values, deathsRow.Values))
 			if err != nil {
 				return err
 			}
-
-			prevConfirmed = confirmed
-			prevDeaths = deaths
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
+	if err := refresh.apply(tx, jhu.dialect, confirmedAndDeathsSummary); err != nil {
 		return err
 	}
 
-	log.Println("Done updating confirmed and deaths")
-	return nil
+	if latest != "" {
+		if err := jhu.setLatestDate(tx, latest, dates); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
-func (jhu jhuCsseDataCollector) UpdateRecoveries() error {
-	recoveriesResponse, err := http.Get(recoveriesSrc)
+// saveCounties stores the FIPS code and population of the counties of t.
+func (jhu jhuCsseDataCollector) saveCounties(t *seriesTable) error {
+	countryAliases, err := loadAliases(jhu.db)
+	if err != nil {
+		return err
+	}
 
+	tx, err := jhu.db.Begin()
 	if err != nil {
 		return err
 	}
-	defer recoveriesResponse.Body.Close()
+	defer tx.Rollback()
 
-	recoveriesReader := csv.NewReader(recoveriesResponse.Body)
+	stmt, err := tx.Prepare(jhu.dialect.upsert(
+		"counties",
+		[]string{"country", "country_slug", "province", "county", "fips", "population"},
+		[]string{"country_slug", "province", "county"},
+		[]string{"country", "fips", "population"},
+	))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, row := range t.Rows {
+		population := sql.NullInt64{Int64: row.Population, Valid: row.Population > 0}
+		countrySlug := countryAliases.canonical(generateCountrySlug(row.Country))
+
+		if _, err := stmt.Exec(row.Country, countrySlug, row.Province, row.County, row.FIPS, population); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (jhu jhuCsseDataCollector) updateRecoveries(report *IngestReport) error {
+	recoveries, err := jhu.readSeries(RecoveriesGlobalSeries, parseSeries)
+	if err != nil {
+		return err
+	}
 
-	headers, err := recoveriesReader.Read()
+	report.RowsRead = len(recoveries.Rows)
+	report.cover(recoveries.Dates)
+	recoveriesRows := recoveries.index(RecoveriesGlobalSeries, report)
+
+	countryAliases, err := loadAliases(jhu.db)
 	if err != nil {
 		return err
 	}
 
-	dates := headers[4:]
+	stored, err := jhu.loadStoredSeries(`
+	select s.country_slug, s.province, s.county, s.latest, s.dates, c.recoveries, s.recoveries
+	from (
+		select country_slug, province, county, MAX(date_recorded) latest, COUNT(*) dates, SUM(recoveries) recoveries
+		from recoveries_time_series group by country_slug, province, county
+	) s
+	left join series_checksums c on c.country_slug = s.country_slug and c.province = s.province and c.county = s.county
+	`)
+	if err != nil {
+		return err
+	}
+
+	dates := recoveries.Dates
 
 	tx, err := jhu.db.Begin()
 	if err != nil {
@@ -161,65 +411,474 @@ func (jhu jhuCsseDataCollector) UpdateRecoveries() error {
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(`INSERT INTO recoveries_time_series 
-	(province,country,country_slug,latitude,longitude,recoveries,new_recoveries,date_recorded) 
-	VALUES (?,?,?,?,?,?,?,?)
-	ON DUPLICATE KEY UPDATE recoveries = VALUES(recoveries), new_recoveries = VALUES(new_recoveries)
-	`)
+	stmt, err := tx.Prepare(jhu.dialect.upsert(
+		recoveriesTable,
+		[]string{"province", "country", "country_slug", "latitude", "longitude", "recoveries", "new_recoveries", "date_recorded"},
+		[]string{"country_slug", "province", "date_recorded"},
+		[]string{"recoveries", "new_recoveries"},
+	))
 
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
+	checksums, err := jhu.saveChecksum(tx, "recoveries")
+	if err != nil {
+		return err
+	}
+	defer checksums.Close()
+
+	refresh := summaryRefresh{}
+
+	for _, row := range recoveries.Rows {
+		if _, ok := recoveriesRows[row.key()]; !ok {
+			continue
+		}
+
+		countrySlug := countryAliases.canonical(generateCountrySlug(row.Country))
+
+		s := stored[storedKey{countrySlug, row.Province, row.County}]
+		start := s.pending(dates, row.Values)
+
+		prevRecoveries := 0
+		if start > 0 {
+			prevRecoveries = row.Values[start-1]
+		}
+
+		for j := start; j < len(dates); j++ {
+			recoveries := row.Values[j]
+
+			_, err = stmt.Exec(row.Province, row.Country, countrySlug, row.Latitude, row.Longitude, recoveries, max(0, recoveries-prevRecoveries), dates[j])
+			if err != nil {
+				return err
+			}
+
+			prevRecoveries = recoveries
+			report.written(countrySlug, s, dates[j])
+			refresh.add(countrySlug, dates[j])
+		}
+
+		if start < len(dates) {
+			if _, err := checksums.Exec(countrySlug, row.Province, row.County, checksum(len(dates), row.Values)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := refresh.apply(tx, jhu.dialect, recoveriesSummary); err != nil {
+		return err
+	}
+
+	if err := jhu.setLatestDate(tx, recoveriesTable, dates); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Done updating recoveries (%d rows inserted, %d rows updated, %d locations unmatched)\n", report.RowsInserted, report.RowsUpdated, len(report.Unmatched))
+	return nil
+}
+
+// setLatestDate records the last date of an ingested series as the latest complete date of table,
+// since every row of a JHU CSSE series has a value for each of its dates.
+func (jhu jhuCsseDataCollector) setLatestDate(tx *sql.Tx, table string, dates []time.Time) error {
+	if len(dates) == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(jhu.dialect.upsert(
+		"ingest_metadata",
+		[]string{"table_name", "latest_date", "updated_at"},
+		[]string{"table_name"},
+		[]string{"latest_date", "updated_at"},
+	), table, dates[len(dates)-1], time.Now().UTC())
+
+	return err
+}
+
+// readSeries opens the named series from the collector's source and parses it with parse.
+func (jhu jhuCsseDataCollector) readSeries(name string, parse func(io.Reader) (*seriesTable, error)) (*seriesTable, error) {
+	body, _, err := jhu.src.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return parse(body)
+}
+
+// loadStoredSeries runs query, which must select the country slug, province, county, latest date,
+// number of dates, checksum and one or more sums of cumulative values per location.
+func (jhu jhuCsseDataCollector) loadStoredSeries(query string) (map[storedKey]*storedSeries, error) {
+	rows, err := jhu.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[storedKey]*storedSeries)
+
+	for rows.Next() {
+		key := storedKey{}
+		series := &storedSeries{sums: make([]int64, len(columns)-6)}
+		var checksum sql.NullString
+
+		dest := []interface{}{&key.CountrySlug, &key.Province, &key.County, scanTime{&series.latest}, &series.count, &checksum}
+		for i := range series.sums {
+			dest = append(dest, &series.sums[i])
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		series.checksum = checksum.String
+		stored[key] = series
+	}
+
+	return stored, rows.Err()
+}
+
+// pending returns the index of the first date that has to be written for a location.
+// Dates up to the latest stored date are only skipped when the stored values still add up
+// to the CSV's and have its checksum, which catches revisions that move cases between dates;
+// otherwise the location was revised retroactively and is rewritten in full.
+func (s *storedSeries) pending(dates []time.Time, columns ...[]int) int {
+	if s == nil {
+		return 0
+	}
+
+	n := 0
+	for n < len(dates) && !dates[n].After(s.latest) {
+		n++
+	}
+
+	if n != s.count {
+		return 0
+	}
+
+	for i, values := range columns {
+		var sum int64
+		for _, v := range values[:n] {
+			sum += int64(v)
+		}
+
+		if sum != s.sums[i] {
+			return 0
+		}
+	}
+
+	if s.checksum != "" && s.checksum != checksum(n, columns...) {
+		return 0
+	}
+
+	return n
+}
+
+// checksum returns the FNV-1a hash of the first n values of each of columns, in order.
+func checksum(n int, columns ...[]int) string {
+	h := fnv.New64a()
+	var b [8]byte
+
+	for _, values := range columns {
+		for _, v := range values[:n] {
+			binary.BigEndian.PutUint64(b[:], uint64(v))
+			h.Write(b[:])
+		}
+	}
+
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// saveChecksum returns a statement recording the checksum of a location of the named series.
+func (jhu jhuCsseDataCollector) saveChecksum(tx *sql.Tx, series string) (*sql.Stmt, error) {
+	return tx.Prepare(jhu.dialect.upsert(
+		"series_checksums",
+		[]string{"country_slug", "province", "county", series},
+		[]string{"country_slug", "province", "county"},
+		[]string{series},
+	))
+}
+
+// index keys the table's rows by location. Locations that appear more than once are
+// ambiguous, so they are left out of the index and recorded in report.
+func (t *seriesTable) index(series string, report *IngestReport) map[locationKey]seriesRow {
+	rows := make(map[locationKey]seriesRow, len(t.Rows))
+	duplicates := make(map[locationKey]bool)
+
+	for _, row := range t.Rows {
+		key := row.key()
+
+		if _, ok := rows[key]; ok {
+			duplicates[key] = true
+		}
+		rows[key] = row
+	}
+
+	for _, row := range t.Rows {
+		key := row.key()
+
+		if duplicates[key] {
+			delete(rows, key)
+			delete(duplicates, key)
+			report.unmatched(key, series, "duplicate location")
+		}
+	}
+
+	return rows
+}
+
+// withCounties returns the rows of t that have a county and records the others in report.
+func (t *seriesTable) withCounties(series string, report *IngestReport) []seriesRow {
+	rows := []seriesRow{}
+
+	for _, row := range t.Rows {
+		if row.County == "" {
+			report.unmatched(row.key(), series, "no county")
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// cover records the range of dates read by an update.
+func (r *IngestReport) cover(dates []time.Time) {
+	if len(dates) > 0 {
+		r.FirstDate = &dates[0]
+		r.LastDate = &dates[len(dates)-1]
+	}
+}
+
+// written counts a row written for date at a location of countrySlug already holding s.
+func (r *IngestReport) written(countrySlug string, s *storedSeries, date time.Time) {
+	if s != nil && !date.After(s.latest) {
+		r.RowsUpdated++
+	} else {
+		r.RowsInserted++
+	}
+
+	if !r.changed[countrySlug] {
+		if r.changed == nil {
+			r.changed = make(map[string]bool)
+		}
+		r.changed[countrySlug] = true
+		r.Countries = append(r.Countries, countrySlug)
+	}
+}
+
+func (r *IngestReport) unmatched(key locationKey, series string, reason string) {
+	r.Unmatched = append(r.Unmatched, UnmatchedLocation{
+		Province: key.Province,
+		Country:  key.Country,
+		County:   key.County,
+		Series:   series,
+		Reason:   reason,
+	})
+}
+
+// parseSeries parses a JHU CSSE time series CSV: Province/State, Country/Region, Lat, Long
+// followed by one column of cumulative values per date.
+func parseSeries(r io.Reader) (*seriesTable, error) {
+	reader := csv.NewReader(r)
+
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(headers) < 4 {
+		return nil, fmt.Errorf("unexpected series header: %v", headers)
+	}
+
+	table := new(seriesTable)
+
+	for _, header := range headers[4:] {
+		date, err := time.Parse("1/2/06", header)
+		if err != nil {
+			return nil, err
+		}
+
+		table.Dates = append(table.Dates, date)
+	}
+
 	for {
-		row, err := recoveriesReader.Read()
+		record, err := reader.Read()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return err
+			return nil, err
 		}
 
-		lat, err := parseFloatWithCheck(row[2], 64)
+		lat, err := parseFloatWithCheck(record[2], 64)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		long, err := parseFloatWithCheck(row[3], 64)
+		long, err := parseFloatWithCheck(record[3], 64)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		prevRecoveries := 0
+		row := seriesRow{
+			Province:  record[0],
+			Country:   record[1],
+			Latitude:  lat,
+			Longitude: long,
+			Values:    make([]int, len(table.Dates)),
+		}
 
-		for j := 0; j < len(dates); j++ {
-			recoveries, err := strconv.Atoi(row[j+4])
+		for j := range table.Dates {
+			row.Values[j], err = strconv.Atoi(record[j+4])
 			if err != nil {
-				return err
+				return nil, err
 			}
-			date, err := time.Parse("1/2/06", dates[j])
+		}
+
+		table.Rows = append(table.Rows, row)
+	}
+
+	return table, nil
+}
+
+// usSeriesColumns are the columns of the JHU CSSE US time series that parseUSSeries reads.
+// The deaths series also has a Population column before the dates.
+var usSeriesColumns = []string{"FIPS", "Admin2", "Province_State", "Country_Region", "Lat", "Long_", "Combined_Key"}
+
+// parseUSSeries parses a JHU CSSE US time series CSV, which has one row per county with its FIPS code
+// and, for deaths, its population, followed by one column of cumulative values per date.
+func parseUSSeries(r io.Reader) (*seriesTable, error) {
+	reader := csv.NewReader(r)
+
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	column := make(map[string]int, len(headers))
+	for i, header := range headers {
+		column[header] = i
+	}
+
+	// The dates follow the last of the other columns.
+	first := 0
+	for _, name := range usSeriesColumns {
+		i, ok := column[name]
+		if !ok {
+			return nil, fmt.Errorf("unexpected US series header: missing %s in %v", name, headers)
+		}
+		first = max(first, i+1)
+	}
+
+	if i, ok := column["Population"]; ok {
+		first = max(first, i+1)
+	}
+
+	table := new(seriesTable)
+
+	for _, header := range headers[first:] {
+		date, err := time.Parse("1/2/06", header)
+		if err != nil {
+			return nil, err
+		}
+
+		table.Dates = append(table.Dates, date)
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		lat, err := parseFloatWithCheck(record[column["Lat"]], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		long, err := parseFloatWithCheck(record[column["Long_"]], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		fips, err := parseFIPS(record[column["FIPS"]])
+		if err != nil {
+			return nil, err
+		}
+
+		row := seriesRow{
+			Province:  record[column["Province_State"]],
+			Country:   record[column["Country_Region"]],
+			County:    record[column["Admin2"]],
+			FIPS:      fips,
+			Latitude:  lat,
+			Longitude: long,
+			Values:    make([]int, len(table.Dates)),
+		}
+
+		if i, ok := column["Population"]; ok && record[i] != "" {
+			row.Population, err = strconv.ParseInt(record[i], 10, 64)
 			if err != nil {
-				return err
+				return nil, err
 			}
+		}
 
-			_, err = stmt.Exec(row[0], row[1], generateCountrySlug(row[1]), lat, long, recoveries, max(0, recoveries-prevRecoveries), date)
+		for j := range table.Dates {
+			row.Values[j], err = strconv.Atoi(record[j+first])
 			if err != nil {
-				return err
+				return nil, err
 			}
-
-			prevRecoveries = recoveries
 		}
+
+		table.Rows = append(table.Rows, row)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return err
+	return table, nil
+}
+
+// parseFIPS formats a FIPS code, which the US series write as a number such as 1001.0, with its
+// five digits. It returns an empty string for a missing code.
+func parseFIPS(s string) (string, error) {
+	if s == "" {
+		return "", nil
 	}
 
-	log.Println("Done updating recoveries")
-	return nil
+	code, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%05d", int(code)), nil
 }
 
+// accents replaces accented letters with their unaccented form so generateCountrySlug keeps them.
+var accents = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a",
+	"ç", "c",
+	"è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i",
+	"ñ", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u",
+	"ý", "y", "ÿ", "y",
+)
+
+// generateCountrySlug derives a slug from a JHU CSSE country name. Slugs of renamed countries are
+// aliases of their canonical slug, which is looked up with aliases.canonical.
 func generateCountrySlug(country string) string {
+	country = accents.Replace(strings.ToLower(country))
+
 	r := regexp.MustCompile("[^a-zA-Z- ]")
 	country = r.ReplaceAllString(country, "")
 
@@ -229,6 +888,23 @@ func generateCountrySlug(country string) string {
 	return strings.ToLower(country)
 }
 
+// accentStrippedSlug is the slug generateCountrySlug derived for country before accented letters were
+// transliterated, when they were dropped instead.
+func accentStrippedSlug(country string) string {
+	r := regexp.MustCompile("[^a-zA-Z- ]")
+	return strings.ReplaceAll(r.ReplaceAllString(strings.ToLower(country), ""), " ", "-")
+}
+
+// generateProvinceSlug derives a slug from a JHU CSSE province name the same way as generateCountrySlug.
+func generateProvinceSlug(province string) string {
+	return generateCountrySlug(province)
+}
+
+// generateCountySlug derives a slug from a JHU CSSE county name the same way as generateCountrySlug.
+func generateCountySlug(county string) string {
+	return generateCountrySlug(county)
+}
+
 func max(x, y int) int {
 	if x < y {
 		return y
@@ -236,6 +912,10 @@ func max(x, y int) int {
 	return x
 }
 
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
 func parseFloatWithCheck(s string, bitSize int) (float64, error) {
 	if s == "" {
 		return strconv.ParseFloat("0.0", bitSize)
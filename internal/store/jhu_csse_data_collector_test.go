@@ -1,6 +1,10 @@
 package store
 
-import "testing"
+import (
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestGenerateCountrySlug(t *testing.T) {
 	input := "United Kingdom"
@@ -34,6 +38,14 @@ func TestGenerateCountrySlug(t *testing.T) {
 	if got != want {
 		t.Errorf("generateCountrySlug(%s) = %s; want %s", input, got, want)
 	}
+
+	input = "Côte d'Ivoire"
+	got = generateCountrySlug(input)
+	want = "cote-divoire"
+
+	if got != want {
+		t.Errorf("generateCountrySlug(%s) = %s; want %s", input, got, want)
+	}
 }
 
 func TestMax(t *testing.T) {
@@ -50,3 +62,128 @@ func TestMax(t *testing.T) {
 		t.Errorf("max(-77,0) = %d; want %d", got, want)
 	}
 }
+
+func TestParseSeries(t *testing.T) {
+	input := "Province/State,Country/Region,Lat,Long,1/22/20,1/23/20,1/24/20\n" +
+		"Ontario,Canada,51.25,-85.32,1,3,6\n" +
+		",Italy,,,0,0,2\n"
+
+	table, err := parseSeries(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(table.Dates), 3; got != want {
+		t.Fatalf("len(Dates) = %d; want %d", got, want)
+	}
+
+	if got, want := table.Dates[2], time.Date(2020, 1, 24, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Dates[2] = %v; want %v", got, want)
+	}
+
+	if got, want := len(table.Rows), 2; got != want {
+		t.Fatalf("len(Rows) = %d; want %d", got, want)
+	}
+
+	if got, want := table.Rows[0].Province, "Ontario"; got != want {
+		t.Errorf("Rows[0].Province = %s; want %s", got, want)
+	}
+
+	if got, want := table.Rows[1].Values[2], 2; got != want {
+		t.Errorf("Rows[1].Values[2] = %d; want %d", got, want)
+	}
+}
+
+func TestParseUSSeries(t *testing.T) {
+	input := "UID,iso2,iso3,code3,FIPS,Admin2,Province_State,Country_Region,Lat,Long_,Combined_Key,Population,1/22/20,1/23/20\n" +
+		"84001001,US,USA,840,1001.0,Autauga,Alabama,US,32.54,-86.64,\"Autauga, Alabama, US\",55869,0,4\n" +
+		"16,AS,ASM,16,60.0,,American Samoa,US,-14.27,-170.13,\"American Samoa, US\",55641,0,0\n"
+
+	table, err := parseUSSeries(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(table.Dates), 2; got != want {
+		t.Fatalf("len(Dates) = %d; want %d", got, want)
+	}
+
+	if got, want := len(table.Rows), 2; got != want {
+		t.Fatalf("len(Rows) = %d; want %d", got, want)
+	}
+
+	row := table.Rows[0]
+	if row.County != "Autauga" || row.Province != "Alabama" || row.Country != "US" {
+		t.Errorf("Rows[0] is %s, %s, %s; want Autauga, Alabama, US", row.County, row.Province, row.Country)
+	}
+
+	if got, want := row.FIPS, "01001"; got != want {
+		t.Errorf("Rows[0].FIPS = %s; want %s", got, want)
+	}
+
+	if got, want := row.Population, int64(55869); got != want {
+		t.Errorf("Rows[0].Population = %d; want %d", got, want)
+	}
+
+	if got, want := row.Values[1], 4; got != want {
+		t.Errorf("Rows[0].Values[1] = %d; want %d", got, want)
+	}
+}
+
+func TestStoredSeriesPending(t *testing.T) {
+	dates := []time.Time{
+		time.Date(2020, 1, 22, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 23, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 24, 0, 0, 0, 0, time.UTC),
+	}
+	values := []int{1, 3, 6}
+
+	var missing *storedSeries
+	if got, want := missing.pending(dates, values), 0; got != want {
+		t.Errorf("pending() for a new location = %d; want %d", got, want)
+	}
+
+	upToDate := &storedSeries{latest: dates[1], count: 2, sums: []int64{4}}
+	if got, want := upToDate.pending(dates, values), 2; got != want {
+		t.Errorf("pending() for an unrevised location = %d; want %d", got, want)
+	}
+
+	revised := &storedSeries{latest: dates[1], count: 2, sums: []int64{5}}
+	if got, want := revised.pending(dates, values), 0; got != want {
+		t.Errorf("pending() for a revised location = %d; want %d", got, want)
+	}
+
+	gap := &storedSeries{latest: dates[1], count: 1, sums: []int64{3}}
+	if got, want := gap.pending(dates, values), 0; got != want {
+		t.Errorf("pending() for a location with missing dates = %d; want %d", got, want)
+	}
+}
+
+func TestSeriesTableIndex(t *testing.T) {
+	table := &seriesTable{
+		Rows: []seriesRow{
+			{Province: "Ontario", Country: "Canada"},
+			{Province: "", Country: "Italy"},
+			{Province: "Ontario", Country: "Canada"},
+		},
+	}
+	report := new(IngestReport)
+
+	rows := table.index(ConfirmedGlobalSeries, report)
+
+	if _, ok := rows[locationKey{Country: "Italy"}]; !ok {
+		t.Errorf("index() is missing Italy")
+	}
+
+	if _, ok := rows[locationKey{Province: "Ontario", Country: "Canada"}]; ok {
+		t.Errorf("index() kept the duplicated Ontario, Canada")
+	}
+
+	if got, want := len(report.Unmatched), 1; got != want {
+		t.Fatalf("len(Unmatched) = %d; want %d", got, want)
+	}
+
+	if got, want := report.Unmatched[0].Reason, "duplicate location"; got != want {
+		t.Errorf("Unmatched[0].Reason = %s; want %s", got, want)
+	}
+}
@@ -0,0 +1,241 @@
+package store
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations live in migrations/<dialect>/ as <version>_<name>.up.sql and
+// <version>_<name>.down.sql. Applied versions are recorded in schema_migrations.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	up      string
+	down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time `json:"appliedAt"`
+}
+
+const createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version BIGINT NOT NULL PRIMARY KEY,
+	applied_at DATETIME NOT NULL
+)`
+
+// MigrateUp applies every migration st has not applied yet, oldest first,
+// and returns the migrations it applied.
+func MigrateUp(st Service) ([]Migration, error) {
+	db, migrations, applied, err := prepareMigrations(st)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		err := runMigration(db, m.up, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, m.Version, time.Now().UTC())
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		done = append(done, m)
+	}
+
+	return done, nil
+}
+
+// MigrateDown reverts the last steps migrations applied to st, newest first,
+// and returns the migrations it reverted.
+func MigrateDown(st Service, steps int) ([]Migration, error) {
+	db, migrations, applied, err := prepareMigrations(st)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+
+		err := runMigration(db, m.down, `DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		done = append(done, m)
+	}
+
+	return done, nil
+}
+
+// GetMigrationStatus lists every migration known to st's dialect and when it was applied.
+func GetMigrationStatus(st Service) ([]MigrationStatus, error) {
+	_, migrations, applied, err := prepareMigrations(st)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		status[i].Migration = m
+		if appliedAt, ok := applied[m.Version]; ok {
+			status[i].AppliedAt = &appliedAt
+		}
+	}
+
+	return status, nil
+}
+
+func prepareMigrations(st Service) (*sql.DB, []Migration, map[int]time.Time, error) {
+	db, err := st.GetDbInstance()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	migrations, err := loadMigrations(dialectOf(st).name())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if _, err := db.Exec(createSchemaMigrations); err != nil {
+		return nil, nil, nil, err
+	}
+
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+
+		if err := rows.Scan(&version, scanTime{&appliedAt}); err != nil {
+			return nil, nil, nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return db, migrations, applied, rows.Err()
+}
+
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+
+		contents, err := migrationFiles.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+
+		if direction == "up" {
+			m.up = string(contents)
+		} else {
+			m.down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// runMigration executes the statements of script and then record in one transaction.
+// MySQL commits DDL statements implicitly, so a failing MySQL migration may be half applied.
+func runMigration(db *sql.DB, script string, record string, args ...interface{}) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range splitStatements(script) {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// splitStatements splits script on semicolons that end a line, since the MySQL driver
+// runs a single statement per Exec.
+func splitStatements(script string) []string {
+	statements := []string{}
+
+	for _, statement := range strings.Split(script, ";\n") {
+		statement = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(statement), ";"))
+		if statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+
+	return statements
+}
@@ -0,0 +1,64 @@
+package store
+
+import "testing"
+
+func TestMigrations(t *testing.T) {
+	for _, dialect := range []string{"mysql", "sqlite"} {
+		migrations, err := loadMigrations(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("%s migration %s has version %d; want %d", dialect, m.Name, m.Version, i+1)
+			}
+			if m.up == "" || m.down == "" {
+				t.Errorf("%s migration %d_%s is missing its up or down script", dialect, m.Version, m.Name)
+			}
+		}
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	st := newTestStore(t)
+
+	status, err := GetMigrationStatus(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			t.Errorf("migration %d_%s was not applied", s.Version, s.Name)
+		}
+	}
+
+	reverted, err := MigrateDown(st, len(status))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(reverted), len(status); got != want {
+		t.Errorf("MigrateDown() reverted %d migrations; want %d", got, want)
+	}
+
+	applied, err := MigrateUp(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(applied), len(status); got != want {
+		t.Errorf("MigrateUp() applied %d migrations; want %d", got, want)
+	}
+
+	ingest(t, st, testSource())
+}
+
+func TestSplitStatements(t *testing.T) {
+	got := splitStatements("CREATE TABLE a (id INT);\n\nCREATE TABLE b (id INT);\n")
+
+	if len(got) != 2 || got[0] != "CREATE TABLE a (id INT)" || got[1] != "CREATE TABLE b (id INT)" {
+		t.Errorf("splitStatements() = %q", got)
+	}
+}
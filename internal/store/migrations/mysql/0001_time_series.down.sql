@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `recoveries_time_series`;
+DROP TABLE IF EXISTS `confirmed_and_deaths_time_series`;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS `confirmed_and_deaths_time_series` (
+  `id` int unsigned NOT NULL AUTO_INCREMENT,
+  `country` varchar(255) NOT NULL,
+  `country_slug` varchar(255) NOT NULL,
+  `province` varchar(255) NOT NULL DEFAULT '',
+  `county` varchar(255) NOT NULL DEFAULT '',
+  `deaths` bigint unsigned NOT NULL DEFAULT '0',
+  `confirmed_cases` bigint unsigned NOT NULL DEFAULT '0',
+  `date_recorded` date NOT NULL,
+  `latitude` double DEFAULT NULL,
+  `longitude` double DEFAULT NULL,
+  `new_confirmed` bigint unsigned NOT NULL DEFAULT '0',
+  `new_deaths` bigint unsigned NOT NULL DEFAULT '0',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `location_date_index` (`country_slug`,`province`,`county`,`date_recorded`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `recoveries_time_series` (
+  `id` int unsigned NOT NULL AUTO_INCREMENT,
+  `country` varchar(255) NOT NULL DEFAULT '',
+  `country_slug` varchar(255) NOT NULL,
+  `province` varchar(255) NOT NULL DEFAULT '',
+  `latitude` double DEFAULT NULL,
+  `longitude` double DEFAULT NULL,
+  `recoveries` bigint unsigned NOT NULL DEFAULT '0',
+  `date_recorded` date NOT NULL,
+  `new_recoveries` bigint unsigned NOT NULL DEFAULT '0',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `location_date_index` (`country_slug`,`province`,`date_recorded`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
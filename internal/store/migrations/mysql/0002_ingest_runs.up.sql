@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS `ingest_runs` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `series` varchar(255) NOT NULL,
+  `source` varchar(1024) NOT NULL DEFAULT '',
+  `started_at` datetime NOT NULL,
+  `finished_at` datetime NOT NULL,
+  `rows_read` int unsigned NOT NULL DEFAULT '0',
+  `rows_inserted` int unsigned NOT NULL DEFAULT '0',
+  `rows_updated` int unsigned NOT NULL DEFAULT '0',
+  `rows_skipped` int unsigned NOT NULL DEFAULT '0',
+  `first_date` date DEFAULT NULL,
+  `last_date` date DEFAULT NULL,
+  `error` text,
+  PRIMARY KEY (`id`),
+  KEY `started_at_index` (`started_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,16 @@
+CREATE TABLE `ingest_metadata` (
+  `table_name` varchar(255) NOT NULL,
+  `latest_date` date NOT NULL,
+  `updated_at` datetime NOT NULL,
+  PRIMARY KEY (`table_name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+INSERT INTO `ingest_metadata` (`table_name`, `latest_date`, `updated_at`)
+SELECT 'confirmed_and_deaths_time_series', m.latest_date, UTC_TIMESTAMP()
+FROM (SELECT MAX(`date_recorded`) latest_date FROM `confirmed_and_deaths_time_series`) m
+WHERE m.latest_date IS NOT NULL;
+
+INSERT INTO `ingest_metadata` (`table_name`, `latest_date`, `updated_at`)
+SELECT 'recoveries_time_series', m.latest_date, UTC_TIMESTAMP()
+FROM (SELECT MAX(`date_recorded`) latest_date FROM `recoveries_time_series`) m
+WHERE m.latest_date IS NOT NULL;
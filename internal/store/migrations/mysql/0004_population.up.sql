@@ -0,0 +1,6 @@
+CREATE TABLE `population` (
+  `country_slug` varchar(255) NOT NULL,
+  `province` varchar(255) NOT NULL DEFAULT '',
+  `population` bigint unsigned NOT NULL,
+  PRIMARY KEY (`country_slug`,`province`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
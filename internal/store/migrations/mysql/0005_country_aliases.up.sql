@@ -0,0 +1,5 @@
+CREATE TABLE `country_aliases` (
+  `alias` varchar(255) NOT NULL,
+  `country_slug` varchar(255) NOT NULL,
+  PRIMARY KEY (`alias`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,10 @@
+CREATE TABLE `countries` (
+  `country_slug` varchar(255) NOT NULL,
+  `iso2` char(2) NOT NULL,
+  `iso3` char(3) NOT NULL,
+  `continent` varchar(255) NOT NULL,
+  `who_region` varchar(255) NOT NULL,
+  PRIMARY KEY (`country_slug`),
+  KEY `idx_countries_continent` (`continent`),
+  KEY `idx_countries_who_region` (`who_region`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `counties`;
+
+ALTER TABLE `recoveries_time_series` DROP COLUMN `county`;
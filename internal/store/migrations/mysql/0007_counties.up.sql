@@ -0,0 +1,11 @@
+ALTER TABLE `recoveries_time_series` ADD COLUMN `county` varchar(255) NOT NULL DEFAULT '' AFTER `province`;
+
+CREATE TABLE `counties` (
+  `country` varchar(255) NOT NULL,
+  `country_slug` varchar(255) NOT NULL,
+  `province` varchar(255) NOT NULL,
+  `county` varchar(255) NOT NULL,
+  `fips` varchar(5) NOT NULL DEFAULT '',
+  `population` bigint unsigned DEFAULT NULL,
+  PRIMARY KEY (`country_slug`,`province`,`county`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
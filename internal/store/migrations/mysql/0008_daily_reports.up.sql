@@ -0,0 +1,16 @@
+CREATE TABLE `daily_reports` (
+  `country` varchar(255) NOT NULL,
+  `country_slug` varchar(255) NOT NULL,
+  `province` varchar(255) NOT NULL DEFAULT '',
+  `county` varchar(255) NOT NULL DEFAULT '',
+  `date_reported` date NOT NULL,
+  `last_update` datetime DEFAULT NULL,
+  `confirmed` bigint unsigned NOT NULL DEFAULT '0',
+  `deaths` bigint unsigned NOT NULL DEFAULT '0',
+  `recovered` bigint DEFAULT NULL,
+  `active` bigint DEFAULT NULL,
+  `incidence_rate` double DEFAULT NULL,
+  `case_fatality_ratio` double DEFAULT NULL,
+  PRIMARY KEY (`country_slug`,`province`,`county`,`date_reported`),
+  KEY `idx_daily_reports_date_reported` (`date_reported`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
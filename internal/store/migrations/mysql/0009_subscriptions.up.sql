@@ -0,0 +1,24 @@
+CREATE TABLE `subscriptions` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `url` varchar(2048) NOT NULL,
+  `secret` varchar(255) NOT NULL,
+  `country_slug` varchar(255) NOT NULL,
+  `metric` varchar(255) NOT NULL,
+  `rule` varchar(255) NOT NULL,
+  `threshold` double NOT NULL,
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `webhook_deliveries` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `subscription_id` bigint unsigned NOT NULL,
+  `date_reported` date NOT NULL,
+  `attempt` int unsigned NOT NULL,
+  `status_code` int DEFAULT NULL,
+  `error` text,
+  `payload` text NOT NULL,
+  `attempted_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_webhook_deliveries_subscription_id` (`subscription_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
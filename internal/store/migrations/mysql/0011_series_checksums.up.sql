@@ -0,0 +1,8 @@
+CREATE TABLE `series_checksums` (
+  `country_slug` varchar(255) NOT NULL,
+  `province` varchar(255) NOT NULL DEFAULT '',
+  `county` varchar(255) NOT NULL DEFAULT '',
+  `confirmed_and_deaths` varchar(16) DEFAULT NULL,
+  `recoveries` varchar(16) DEFAULT NULL,
+  PRIMARY KEY (`country_slug`,`province`,`county`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS confirmed_and_deaths_time_series (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  country TEXT NOT NULL,
+  country_slug TEXT NOT NULL,
+  province TEXT NOT NULL DEFAULT '',
+  county TEXT NOT NULL DEFAULT '',
+  deaths INTEGER NOT NULL DEFAULT 0,
+  confirmed_cases INTEGER NOT NULL DEFAULT 0,
+  date_recorded DATE NOT NULL,
+  latitude REAL,
+  longitude REAL,
+  new_confirmed INTEGER NOT NULL DEFAULT 0,
+  new_deaths INTEGER NOT NULL DEFAULT 0,
+  UNIQUE (country_slug, province, county, date_recorded)
+);
+
+CREATE TABLE IF NOT EXISTS recoveries_time_series (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  country TEXT NOT NULL DEFAULT '',
+  country_slug TEXT NOT NULL,
+  province TEXT NOT NULL DEFAULT '',
+  latitude REAL,
+  longitude REAL,
+  recoveries INTEGER NOT NULL DEFAULT 0,
+  date_recorded DATE NOT NULL,
+  new_recoveries INTEGER NOT NULL DEFAULT 0,
+  UNIQUE (country_slug, province, date_recorded)
+);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS ingest_runs (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  series TEXT NOT NULL,
+  source TEXT NOT NULL DEFAULT '',
+  started_at DATETIME NOT NULL,
+  finished_at DATETIME NOT NULL,
+  rows_read INTEGER NOT NULL DEFAULT 0,
+  rows_inserted INTEGER NOT NULL DEFAULT 0,
+  rows_updated INTEGER NOT NULL DEFAULT 0,
+  rows_skipped INTEGER NOT NULL DEFAULT 0,
+  first_date DATE,
+  last_date DATE,
+  error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS ingest_runs_started_at_index ON ingest_runs (started_at);
@@ -0,0 +1,15 @@
+CREATE TABLE ingest_metadata (
+  table_name TEXT NOT NULL PRIMARY KEY,
+  latest_date DATE NOT NULL,
+  updated_at DATETIME NOT NULL
+);
+
+INSERT INTO ingest_metadata (table_name, latest_date, updated_at)
+SELECT 'confirmed_and_deaths_time_series', m.latest_date, CURRENT_TIMESTAMP
+FROM (SELECT MAX(date_recorded) latest_date FROM confirmed_and_deaths_time_series) m
+WHERE m.latest_date IS NOT NULL;
+
+INSERT INTO ingest_metadata (table_name, latest_date, updated_at)
+SELECT 'recoveries_time_series', m.latest_date, CURRENT_TIMESTAMP
+FROM (SELECT MAX(date_recorded) latest_date FROM recoveries_time_series) m
+WHERE m.latest_date IS NOT NULL;
@@ -0,0 +1,6 @@
+CREATE TABLE population (
+  country_slug TEXT NOT NULL,
+  province TEXT NOT NULL DEFAULT '',
+  population INTEGER NOT NULL,
+  PRIMARY KEY (country_slug, province)
+);
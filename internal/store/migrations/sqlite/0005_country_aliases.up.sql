@@ -0,0 +1,4 @@
+CREATE TABLE country_aliases (
+  alias TEXT NOT NULL PRIMARY KEY,
+  country_slug TEXT NOT NULL
+);
@@ -0,0 +1,11 @@
+CREATE TABLE countries (
+  country_slug TEXT NOT NULL PRIMARY KEY,
+  iso2 TEXT NOT NULL,
+  iso3 TEXT NOT NULL,
+  continent TEXT NOT NULL,
+  who_region TEXT NOT NULL
+);
+
+CREATE INDEX idx_countries_continent ON countries (continent);
+
+CREATE INDEX idx_countries_who_region ON countries (who_region);
@@ -0,0 +1,11 @@
+ALTER TABLE recoveries_time_series ADD COLUMN county TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE counties (
+  country TEXT NOT NULL,
+  country_slug TEXT NOT NULL,
+  province TEXT NOT NULL,
+  county TEXT NOT NULL,
+  fips TEXT NOT NULL DEFAULT '',
+  population INTEGER,
+  PRIMARY KEY (country_slug, province, county)
+);
@@ -0,0 +1,17 @@
+CREATE TABLE daily_reports (
+  country TEXT NOT NULL,
+  country_slug TEXT NOT NULL,
+  province TEXT NOT NULL DEFAULT '',
+  county TEXT NOT NULL DEFAULT '',
+  date_reported DATE NOT NULL,
+  last_update DATETIME,
+  confirmed INTEGER NOT NULL DEFAULT 0,
+  deaths INTEGER NOT NULL DEFAULT 0,
+  recovered INTEGER,
+  active INTEGER,
+  incidence_rate REAL,
+  case_fatality_ratio REAL,
+  PRIMARY KEY (country_slug, province, county, date_reported)
+);
+
+CREATE INDEX idx_daily_reports_date_reported ON daily_reports (date_reported);
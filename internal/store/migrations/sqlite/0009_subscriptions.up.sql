@@ -0,0 +1,23 @@
+CREATE TABLE subscriptions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  url TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  country_slug TEXT NOT NULL,
+  metric TEXT NOT NULL,
+  rule TEXT NOT NULL,
+  threshold REAL NOT NULL,
+  created_at DATETIME NOT NULL
+);
+
+CREATE TABLE webhook_deliveries (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  subscription_id INTEGER NOT NULL,
+  date_reported DATE NOT NULL,
+  attempt INTEGER NOT NULL,
+  status_code INTEGER,
+  error TEXT,
+  payload TEXT NOT NULL,
+  attempted_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_webhook_deliveries_subscription_id ON webhook_deliveries (subscription_id);
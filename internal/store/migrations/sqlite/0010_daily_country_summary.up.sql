@@ -0,0 +1,35 @@
+CREATE TABLE daily_country_summary (
+  country TEXT NOT NULL,
+  country_slug TEXT NOT NULL,
+  date_recorded DATE NOT NULL,
+  confirmed_cases INTEGER,
+  new_confirmed INTEGER,
+  deaths INTEGER,
+  new_deaths INTEGER,
+  recoveries INTEGER,
+  new_recoveries INTEGER,
+  active INTEGER,
+  PRIMARY KEY (country_slug, date_recorded)
+);
+
+CREATE INDEX idx_daily_country_summary_date_recorded ON daily_country_summary (date_recorded);
+
+INSERT INTO daily_country_summary (country, country_slug, date_recorded, confirmed_cases, new_confirmed, deaths, new_deaths, recoveries, new_recoveries, active)
+SELECT COALESCE(cd.country, r.country), l.country_slug, l.date_recorded, cd.confirmed_cases, cd.new_confirmed, cd.deaths, cd.new_deaths, r.recoveries, r.new_recoveries, dr.active
+FROM (
+  SELECT country_slug, date_recorded FROM confirmed_and_deaths_time_series WHERE county = ''
+  UNION
+  SELECT country_slug, date_recorded FROM recoveries_time_series WHERE county = ''
+) l
+LEFT JOIN (
+  SELECT country_slug, date_recorded, MAX(country) country, SUM(confirmed_cases) confirmed_cases, SUM(new_confirmed) new_confirmed, SUM(deaths) deaths, SUM(new_deaths) new_deaths
+  FROM confirmed_and_deaths_time_series WHERE county = '' GROUP BY country_slug, date_recorded
+) cd ON cd.country_slug = l.country_slug AND cd.date_recorded = l.date_recorded
+LEFT JOIN (
+  SELECT country_slug, date_recorded, MAX(country) country, SUM(recoveries) recoveries, SUM(new_recoveries) new_recoveries
+  FROM recoveries_time_series WHERE county = '' GROUP BY country_slug, date_recorded
+) r ON r.country_slug = l.country_slug AND r.date_recorded = l.date_recorded
+LEFT JOIN (
+  SELECT country_slug, date_reported, SUM(active) active
+  FROM daily_reports GROUP BY country_slug, date_reported
+) dr ON dr.country_slug = l.country_slug AND dr.date_reported = l.date_recorded;
@@ -0,0 +1,8 @@
+CREATE TABLE series_checksums (
+  country_slug TEXT NOT NULL,
+  province TEXT NOT NULL DEFAULT '',
+  county TEXT NOT NULL DEFAULT '',
+  confirmed_and_deaths TEXT,
+  recoveries TEXT,
+  PRIMARY KEY (country_slug, province, county)
+);
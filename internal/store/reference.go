@@ -0,0 +1,365 @@
+package store
+
+import (
+	"database/sql"
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Reference datasets bundled with the binary and loaded by SeedReferenceData.
+//
+//go:embed data
+var referenceFiles embed.FS
+
+// aliases maps alternative country slugs to the canonical slug of the country.
+type aliases map[string]string
+
+// canonical returns the canonical slug for slug, which is slug itself unless it is an alias.
+func (a aliases) canonical(slug string) string {
+	if canonical, ok := a[slug]; ok {
+		return canonical
+	}
+	return slug
+}
+
+// SeedReferenceData loads the bundled reference datasets into st, replacing rows with the same key.
+// Time series stored under a slug that is now an alias, including the slugs that dropped accented
+// letters, are moved to the canonical slug.
+func SeedReferenceData(st Service) error {
+	db, err := st.GetDbInstance()
+	if err != nil {
+		return err
+	}
+
+	dialect := dialectOf(st)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	renamed := aliases{}
+	err = readReferenceFile("data/country_aliases.csv", func(record []string) error {
+		renamed[record[0]] = record[1]
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	countries, err := tx.Prepare(dialect.upsert(
+		"countries",
+		[]string{"country_slug", "iso2", "iso3", "continent", "who_region"},
+		[]string{"country_slug"},
+		[]string{"iso2", "iso3", "continent", "who_region"},
+	))
+	if err != nil {
+		return err
+	}
+	defer countries.Close()
+
+	// ISO 3166 codes resolve to the country too, unless a code is the slug of another country.
+	all := aliases{}
+	canonical := make(map[string]bool)
+
+	err = readReferenceFile("data/countries.csv", func(record []string) error {
+		slug := renamed.canonical(generateCountrySlug(record[0]))
+		canonical[slug] = true
+
+		for _, code := range record[1:3] {
+			all[strings.ToLower(code)] = slug
+		}
+
+		_, err := countries.Exec(slug, record[1], record[2], record[3], record[4])
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	stripped, err := accentStrippedCountries(tx, renamed, canonical)
+	if err != nil {
+		return err
+	}
+	for alias, slug := range stripped {
+		renamed[alias] = slug
+	}
+
+	for alias, slug := range renamed {
+		all[alias] = slug
+	}
+
+	if err := seedAliases(tx, dialect, all, canonical); err != nil {
+		return err
+	}
+
+	if err := renameCountries(tx, dialect, renamed); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(dialect.upsert(
+		"population",
+		[]string{"country_slug", "province", "population"},
+		[]string{"country_slug", "province"},
+		[]string{"population"},
+	))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	err = readReferenceFile("data/population.csv", func(record []string) error {
+		population, err := strconv.ParseInt(record[2], 10, 64)
+		if err != nil {
+			return err
+		}
+
+		_, err = stmt.Exec(renamed.canonical(generateCountrySlug(record[0])), record[1], population)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func seedAliases(tx *sql.Tx, dialect dialect, all aliases, canonical map[string]bool) error {
+	stmt, err := tx.Prepare(dialect.upsert(
+		"country_aliases",
+		[]string{"alias", "country_slug"},
+		[]string{"alias"},
+		[]string{"country_slug"},
+	))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for alias, slug := range all {
+		if alias == slug || canonical[alias] {
+			continue
+		}
+
+		if _, err := stmt.Exec(alias, slug); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// accentStrippedCountries returns the slugs that series are stored under which dropped the accented
+// letters of the country name, mapped to the canonical slug of the country. The slugs are listed
+// from the indexes of the tables, and a name is only read for those that are not canonical.
+func accentStrippedCountries(tx *sql.Tx, renamed aliases, canonical map[string]bool) (aliases, error) {
+	stripped := aliases{}
+
+	for _, table := range []string{confirmedAndDeathsTable, recoveriesTable, "daily_reports"} {
+		slugs, err := distinctCountrySlugs(tx, table)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, slug := range slugs {
+			if canonical[slug] || renamed[slug] != "" || stripped[slug] != "" {
+				continue
+			}
+
+			var country string
+			if err := tx.QueryRow("SELECT country FROM "+table+" WHERE country_slug = ? LIMIT 1", slug).Scan(&country); err != nil {
+				return nil, err
+			}
+
+			if newSlug := generateCountrySlug(country); newSlug != slug && accentStrippedSlug(country) == slug {
+				stripped[slug] = renamed.canonical(newSlug)
+			}
+		}
+	}
+
+	return stripped, nil
+}
+
+func distinctCountrySlugs(tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.Query("SELECT DISTINCT country_slug FROM " + table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	slugs := []string{}
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, err
+		}
+		slugs = append(slugs, slug)
+	}
+
+	return slugs, rows.Err()
+}
+
+// renamedTable is a table whose rows move from a renamed slug to its canonical slug. key holds the
+// columns that identify a row of a country, if any, and series is set if its rows add up to
+// daily_country_summary.
+type renamedTable struct {
+	name   string
+	key    []string
+	series bool
+}
+
+var renamedTables = []renamedTable{
+	{confirmedAndDeathsTable, []string{"province", "county", "date_recorded"}, true},
+	{recoveriesTable, []string{"province", "date_recorded"}, true},
+	{"daily_reports", []string{"province", "county", "date_reported"}, true},
+	{"counties", []string{"province", "county"}, false},
+	{"series_checksums", []string{"province", "county"}, false},
+	{"subscriptions", nil, false},
+}
+
+// renameCountries moves the rows stored under a renamed slug to its canonical slug. Rows that exist under
+// both slugs keep the canonical one. The summary rows of a country whose time series moved are computed
+// again, since they now add up both slugs.
+func renameCountries(tx *sql.Tx, dialect dialect, renamed aliases) error {
+	for alias, slug := range renamed {
+		moved := false
+
+		for _, table := range renamedTables {
+			n, err := moveRows(tx, table, alias, slug)
+			if err != nil {
+				return err
+			}
+
+			if n > 0 && table.series {
+				moved = true
+			}
+		}
+
+		if moved {
+			if err := refreshCountrySummary(tx, dialect, slug); err != nil {
+				return err
+			}
+		}
+
+		for _, table := range []string{"population", "countries", dailyCountrySummaryTable} {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE country_slug = ?", alias); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// moveRows moves the rows of table from alias to slug, first deleting those whose key already exists under
+// slug, and returns the number of rows moved.
+func moveRows(tx *sql.Tx, table renamedTable, alias string, slug string) (int64, error) {
+	if len(table.key) > 0 {
+		conditions := make([]string, len(table.key))
+		for i, column := range table.key {
+			conditions[i] = fmt.Sprintf("c.%s = a.%s", column, column)
+		}
+
+		rows, err := tx.Query(fmt.Sprintf("SELECT a.%s FROM %s a JOIN %s c ON c.country_slug = ? AND %s WHERE a.country_slug = ?",
+			strings.Join(table.key, ", a."), table.name, table.name, strings.Join(conditions, " AND ")), slug, alias)
+		if err != nil {
+			return 0, err
+		}
+
+		// The keys are read in full before they are deleted, since the MySQL driver cannot run a statement
+		// while the rows of another are open.
+		var conflicts [][]interface{}
+		for rows.Next() {
+			key := make([]interface{}, len(table.key))
+			dest := make([]interface{}, len(key))
+			for i := range key {
+				dest[i] = &key[i]
+			}
+
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			conflicts = append(conflicts, key)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		if len(conflicts) > 0 {
+			stmt, err := tx.Prepare(fmt.Sprintf("DELETE FROM %s WHERE country_slug = ? AND %s = ?",
+				table.name, strings.Join(table.key, " = ? AND ")))
+			if err != nil {
+				return 0, err
+			}
+			defer stmt.Close()
+
+			for _, key := range conflicts {
+				if _, err := stmt.Exec(append([]interface{}{alias}, key...)...); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+
+	result, err := tx.Exec("UPDATE "+table.name+" SET country_slug = ? WHERE country_slug = ?", slug, alias)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// loadAliases reads the country_aliases table.
+func loadAliases(db *sql.DB) (aliases, error) {
+	rows, err := db.Query(`SELECT alias, country_slug FROM country_aliases`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	a := aliases{}
+
+	for rows.Next() {
+		var alias, slug string
+		if err := rows.Scan(&alias, &slug); err != nil {
+			return nil, err
+		}
+		a[alias] = slug
+	}
+
+	return a, rows.Err()
+}
+
+// readReferenceFile calls fn with every record of the named bundled CSV file after its header.
+func readReferenceFile(name string, fn func(record []string) error) error {
+	f, err := referenceFiles.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+
+	if _, err := reader.Read(); err != nil {
+		return err
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// JhuCsseBaseUrl is the root of the csse_covid_19_data directory in the JHU CSSE repository.
+const JhuCsseBaseUrl = "https://raw.githubusercontent.com/CSSEGISandData/COVID-19/master/csse_covid_19_data/"
+
+// Names of the series read by the collector, relative to the root of a Source.
+const (
+	ConfirmedGlobalSeries  = "csse_covid_19_time_series/time_series_covid19_confirmed_global.csv"
+	DeathsGlobalSeries     = "csse_covid_19_time_series/time_series_covid19_deaths_global.csv"
+	RecoveriesGlobalSeries = "csse_covid_19_time_series/time_series_covid19_recovered_global.csv"
+	ConfirmedUSSeries      = "csse_covid_19_time_series/time_series_covid19_confirmed_US.csv"
+	DeathsUSSeries         = "csse_covid_19_time_series/time_series_covid19_deaths_US.csv"
+)
+
+// DailyReport returns the name of the daily report of date, relative to the root of a Source.
+func DailyReport(date time.Time) string {
+	return "csse_covid_19_daily_reports/" + date.Format("01-02-2006") + ".csv"
+}
+
+// SeriesInfo describes a series opened from a Source.
+type SeriesInfo struct {
+	Name         string
+	Location     string
+	LastModified time.Time
+}
+
+// Source provides the raw CSV series the collector ingests.
+// Open returns an error wrapping os.ErrNotExist when the named series does not exist.
+type Source interface {
+	Open(name string) (io.ReadCloser, SeriesInfo, error)
+	String() string
+}
+
+type httpSource struct {
+	baseUrl string
+	client  *http.Client
+}
+
+// NewHttpSource returns a Source that fetches series relative to baseUrl.
+func NewHttpSource(baseUrl string, client *http.Client) Source {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if !strings.HasSuffix(baseUrl, "/") {
+		baseUrl += "/"
+	}
+	return httpSource{baseUrl, client}
+}
+
+func (h httpSource) Open(name string) (io.ReadCloser, SeriesInfo, error) {
+	url := h.baseUrl + name
+	info := SeriesInfo{Name: name, Location: url}
+
+	response, err := h.client.Get(url)
+	if err != nil {
+		return nil, info, err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, info, fmt.Errorf("%s: %w", url, os.ErrNotExist)
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, info, fmt.Errorf("%s: unexpected status %s", url, response.Status)
+	}
+
+	if lastModified, err := http.ParseTime(response.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = lastModified
+	}
+
+	return response.Body, info, nil
+}
+
+func (h httpSource) String() string {
+	return h.baseUrl
+}
+
+type dirSource struct {
+	dir string
+}
+
+// NewDirSource returns a Source that reads series from a local directory laid out like csse_covid_19_data.
+func NewDirSource(dir string) Source {
+	return dirSource{dir}
+}
+
+func (d dirSource) Open(name string) (io.ReadCloser, SeriesInfo, error) {
+	p := filepath.Join(d.dir, filepath.FromSlash(name))
+	info := SeriesInfo{Name: name, Location: p}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, info, err
+	}
+
+	if stat, err := f.Stat(); err == nil {
+		info.LastModified = stat.ModTime()
+	}
+
+	return f, info, nil
+}
+
+func (d dirSource) String() string {
+	return d.dir
+}
+
+// MemSource is a Source backed by in-memory series keyed by name.
+type MemSource map[string][]byte
+
+func (m MemSource) Open(name string) (io.ReadCloser, SeriesInfo, error) {
+	info := SeriesInfo{Name: name, Location: path.Join("mem:", name)}
+
+	data, ok := m[name]
+	if !ok {
+		return nil, info, fmt.Errorf("%s: %w", info.Location, os.ErrNotExist)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), info, nil
+}
+
+func (m MemSource) String() string {
+	return "mem:"
+}
+
+// NewSource picks a Source for location: an http(s) URL or a local directory.
+// An empty location selects the JHU CSSE repository on GitHub.
+func NewSource(location string) Source {
+	if location == "" {
+		return NewHttpSource(JhuCsseBaseUrl, nil)
+	}
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return NewHttpSource(location, nil)
+	}
+	return NewDirSource(location)
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testSeries = "Province/State,Country/Region,Lat,Long,1/22/20,1/23/20\n,Test Country,1.5,2.5,1,3\n"
+
+func readSeries(t *testing.T, src Source, name string) string {
+	t.Helper()
+
+	body, _, err := src.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestHttpSource(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/data/"+ConfirmedGlobalSeries {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testSeries))
+	}))
+	defer ts.Close()
+
+	src := NewSource(ts.URL + "/data")
+
+	if got := readSeries(t, src, ConfirmedGlobalSeries); got != testSeries {
+		t.Errorf("Open(%s) = %q; want %q", ConfirmedGlobalSeries, got, testSeries)
+	}
+
+	if _, _, err := src.Open(DeathsGlobalSeries); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open(%s) error = %v; want os.ErrNotExist", DeathsGlobalSeries, err)
+	}
+}
+
+func TestDirSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "covid19-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, filepath.FromSlash(ConfirmedGlobalSeries))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, []byte(testSeries), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := NewSource(dir)
+
+	if got := readSeries(t, src, ConfirmedGlobalSeries); got != testSeries {
+		t.Errorf("Open(%s) = %q; want %q", ConfirmedGlobalSeries, got, testSeries)
+	}
+
+	if _, _, err := src.Open(DeathsGlobalSeries); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open(%s) error = %v; want os.ErrNotExist", DeathsGlobalSeries, err)
+	}
+}
+
+func TestMemSource(t *testing.T) {
+	src := MemSource{ConfirmedGlobalSeries: []byte(testSeries)}
+
+	if got := readSeries(t, src, ConfirmedGlobalSeries); got != testSeries {
+		t.Errorf("Open(%s) = %q; want %q", ConfirmedGlobalSeries, got, testSeries)
+	}
+
+	if _, _, err := src.Open(DeathsGlobalSeries); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open(%s) error = %v; want os.ErrNotExist", DeathsGlobalSeries, err)
+	}
+}
@@ -0,0 +1,1247 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sqlStore implements Service on top of a SQL database. The queries stick to SQL that
+// MySQL and SQLite both understand; anything else goes through the store's dialect.
+type sqlStore struct {
+	db *sql.DB
+	// reads runs the queries outside of a transaction. It is db itself unless writes need a
+	// connection of their own, as they do with SQLite.
+	reads   *sql.DB
+	dialect dialect
+}
+
+// dialect covers the SQL that differs between the databases a sqlStore runs on.
+type dialect interface {
+	// name is the directory holding the dialect's migrations.
+	name() string
+
+	// upsert returns an INSERT into table that updates the update columns
+	// when a row with the same unique key already exists.
+	upsert(table string, columns []string, key []string, update []string) string
+}
+
+// dialectOf returns the dialect to write to st with.
+func dialectOf(st Service) dialect {
+	switch s := st.(type) {
+	case sqlStore:
+		return s.dialect
+	case *CachedService:
+		return dialectOf(s.Service)
+	}
+	return mysqlDialect{}
+}
+
+// statusColumns locates a status in the time series tables.
+type statusColumns struct {
+	table  string
+	amount string
+	new    string
+}
+
+const (
+	confirmedAndDeathsTable = "confirmed_and_deaths_time_series"
+	recoveriesTable         = "recoveries_time_series"
+)
+
+var columnsByStatus = map[string]statusColumns{
+	Confirmed:  {confirmedAndDeathsTable, "confirmed_cases", "new_confirmed"},
+	Deaths:     {confirmedAndDeathsTable, "deaths", "new_deaths"},
+	Recoveries: {recoveriesTable, "recoveries", "new_recoveries"},
+}
+
+func columnsFor(status string) (statusColumns, error) {
+	columns, ok := columnsByStatus[status]
+	if !ok {
+		return columns, fmt.Errorf("unknown status %q", status)
+	}
+	return columns, nil
+}
+
+func (s sqlStore) GetDbInstance() (*sql.DB, error) {
+	return s.db, s.db.Ping()
+}
+
+// GetCountries lists the countries with recoveries on the latest date of daily_country_summary holding any.
+func (s sqlStore) GetCountries() ([]Country, error) {
+	rows, err := s.reads.Query(`
+	select r.country, r.country_slug, COALESCE(c.iso2,''), COALESCE(c.iso3,''), COALESCE(c.continent,''), COALESCE(c.who_region,'')
+	from daily_country_summary r
+	left join countries c on c.country_slug = r.country_slug
+	where r.date_recorded = (select MAX(date_recorded) from daily_country_summary where recoveries is not null)
+	and r.recoveries is not null
+	order by r.country_slug
+	`)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	countryList := []Country{}
+
+	for rows.Next() {
+		country := new(Country)
+		err := rows.Scan(&country.Name, &country.Slug, &country.ISO2, &country.ISO3, &country.Continent, &country.WHORegion)
+
+		if err != nil {
+			return nil, err
+		}
+
+		countryList = append(countryList, *country)
+	}
+
+	return countryList, rows.Err()
+}
+
+func (s sqlStore) GetGlobalStats(date time.Time) (*GlobalStats, error) {
+	globalStats := new(GlobalStats)
+
+	err := s.summaryDates(date, &globalStats.AsOf, &globalStats.RecoveriesAsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	row := s.reads.QueryRow(`select cd.confirmed,cd.new_confirmed,cd.deaths,cd.new_deaths,r.recoveries,r.new_recoveries
+	from (
+		select COALESCE(SUM(confirmed_cases),0) confirmed, COALESCE(SUM(new_confirmed),0) new_confirmed,
+		COALESCE(SUM(deaths),0) deaths, COALESCE(SUM(new_deaths),0) new_deaths
+		from daily_country_summary
+		where date_recorded = ?
+	) cd
+	join (
+		select COALESCE(SUM(recoveries),0) recoveries, COALESCE(SUM(new_recoveries),0) new_recoveries
+		from daily_country_summary
+		where date_recorded = ?
+	) r
+	`, globalStats.AsOf, globalStats.RecoveriesAsOf)
+
+	err = row.Scan(
+		&globalStats.Confirmed,
+		&globalStats.NewConfirmed,
+		&globalStats.Deaths,
+		&globalStats.NewDeaths,
+		&globalStats.Recoveries,
+		&globalStats.NewRecoveries,
+	)
+
+	return globalStats, err
+}
+
+func (s sqlStore) GetSummary(q SummaryQuery) (*Summary, error) {
+	summary := new(Summary)
+
+	regionFilter := ""
+	var regionArgs []interface{}
+
+	if q.Region != "" {
+		region, err := findRegion(q.Region)
+		if err != nil {
+			return nil, err
+		}
+
+		column, value := region.filter()
+		regionFilter = fmt.Sprintf("c.%s = ?", column)
+		regionArgs = append(regionArgs, value)
+		summary.Region = region
+	}
+
+	err := s.summaryDates(q.Date, &summary.AsOf, &summary.RecoveriesAsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	list, totals, err := s.summaryLocations(summary, false, regionFilter, regionArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, locationStats := range list {
+		summary.Confirmed += locationStats.Confirmed
+		summary.NewConfirmed += locationStats.NewConfirmed
+		summary.Recoveries += locationStats.Recoveries
+		summary.NewRecoveries += locationStats.NewRecoveries
+		summary.Deaths += locationStats.Deaths
+		summary.NewDeaths += locationStats.NewDeaths
+	}
+
+	if totals.population > 0 {
+		summary.PerCapitaStats = newPerCapitaStats(summary.CovidStats, totals.population)
+	}
+	summary.DailyReportStats = totals.daily.stats()
+
+	// The totals stay the sum of the countries, since a country's recoveries may not be reported
+	// for the same provinces as its confirmed cases and deaths.
+	if q.Provinces {
+		list, _, err = s.summaryLocations(summary, true, regionFilter, regionArgs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	summary.LocationStatsList = q.apply(list)
+
+	return summary, nil
+}
+
+// summaryTotals adds up the populations and the daily report values of the locations of a summary.
+type summaryTotals struct {
+	population int64
+	daily      dailyReportTotals
+}
+
+// dailyReportTotals adds up the daily report values of one or more locations. The incidence rate of
+// several locations is derived from the confirmed cases of those that have a rate and the population
+// JHU CSSE based each rate on.
+type dailyReportTotals struct {
+	active          sql.NullInt64
+	lastUpdate      time.Time
+	ratedConfirmed  sql.NullFloat64
+	ratedPopulation sql.NullFloat64
+}
+
+func (t *dailyReportTotals) add(other dailyReportTotals) {
+	if other.active.Valid {
+		t.active = sql.NullInt64{Int64: t.active.Int64 + other.active.Int64, Valid: true}
+	}
+	if other.lastUpdate.After(t.lastUpdate) {
+		t.lastUpdate = other.lastUpdate
+	}
+	if other.ratedPopulation.Valid {
+		t.ratedConfirmed = sql.NullFloat64{Float64: t.ratedConfirmed.Float64 + other.ratedConfirmed.Float64, Valid: true}
+		t.ratedPopulation = sql.NullFloat64{Float64: t.ratedPopulation.Float64 + other.ratedPopulation.Float64, Valid: true}
+	}
+}
+
+func (t dailyReportTotals) stats() DailyReportStats {
+	stats := DailyReportStats{}
+
+	if t.active.Valid {
+		active := t.active.Int64
+		stats.Active = &active
+	}
+	if !t.lastUpdate.IsZero() {
+		lastUpdate := t.lastUpdate
+		stats.LastUpdate = &lastUpdate
+	}
+	if t.ratedPopulation.Valid && t.ratedPopulation.Float64 > 0 {
+		rate := t.ratedConfirmed.Float64 * 100000 / t.ratedPopulation.Float64
+		stats.IncidenceRate = &rate
+	}
+
+	return stats
+}
+
+// countriesQuery reads the stats of every country from daily_country_summary, with the recoveries of
+// the row of their own date.
+const countriesQuery = `
+	select cd.country, cd.country_slug, COALESCE(c.iso2,''), COALESCE(c.iso3,''), COALESCE(c.continent,''), COALESCE(c.who_region,''), '',
+	cd.confirmed_cases, cd.new_confirmed, cd.deaths, cd.new_deaths,
+	COALESCE(r.recoveries,0), COALESCE(r.new_recoveries,0), p.population,
+	cd.active, dr.last_update, dr.rated_confirmed, dr.rated_population
+	from daily_country_summary cd
+	left join daily_country_summary r
+	on r.country_slug = cd.country_slug and r.date_recorded = ?
+	left join (
+		select country_slug, MAX(last_update) last_update,
+		SUM(case when incidence_rate > 0 then confirmed end) rated_confirmed,
+		SUM(case when incidence_rate > 0 then confirmed * 100000.0 / incidence_rate end) rated_population
+		from daily_reports
+		where date_reported = ?
+		group by country_slug
+	) dr
+	on cd.country_slug = dr.country_slug
+	left join population p
+	on p.country_slug = cd.country_slug and p.province = ''
+	left join countries c
+	on c.country_slug = cd.country_slug
+	where cd.date_recorded = ? and cd.confirmed_cases is not null%s
+	order by cd.country_slug
+	`
+
+// provincesQuery adds up the stats of every province from the time series tables, which
+// daily_country_summary has no rows for.
+const provincesQuery = `
+	select cd.country, cd.country_slug, COALESCE(c.iso2,''), COALESCE(c.iso3,''), COALESCE(c.continent,''), COALESCE(c.who_region,''), cd.province,
+	cd.total_confirmed, cd.new_confirmed, cd.total_deaths, cd.new_deaths,
+	COALESCE(r.total_recoveries,0), COALESCE(r.new_recoveries,0), p.population,
+	dr.active, dr.last_update, dr.rated_confirmed, dr.rated_population
+	from (
+		select country,country_slug,province,sum(confirmed_cases) total_confirmed, sum(new_confirmed) new_confirmed, sum(deaths) total_deaths, sum(new_deaths) new_deaths
+		from confirmed_and_deaths_time_series
+		where date_recorded = ? and county = ''
+		group by country_slug, country, province
+	) cd
+	left join (
+		select country_slug, province, sum(recoveries) total_recoveries, sum(new_recoveries) new_recoveries
+		from recoveries_time_series
+		where date_recorded = ? and county = ''
+		group by country_slug, province
+	) r
+	on cd.country_slug = r.country_slug and r.province = cd.province
+	left join (
+		select country_slug, province, SUM(active) active, MAX(last_update) last_update,
+		SUM(case when incidence_rate > 0 then confirmed end) rated_confirmed,
+		SUM(case when incidence_rate > 0 then confirmed * 100000.0 / incidence_rate end) rated_population
+		from daily_reports
+		where date_reported = ?
+		group by country_slug, province
+	) dr
+	on cd.country_slug = dr.country_slug and dr.province = cd.province
+	left join population p
+	on p.country_slug = cd.country_slug and p.province = cd.province
+	left join countries c
+	on c.country_slug = cd.country_slug%s
+	order by cd.country_slug, cd.province
+	`
+
+// summaryLocations returns the stats of every country, or of every province of the countries if byProvince is set,
+// on the dates of summary, along with their totals. The daily reports are those of the date of the confirmed cases.
+func (s sqlStore) summaryLocations(summary *Summary, byProvince bool, regionFilter string, regionArgs []interface{}) ([]LocationStats, summaryTotals, error) {
+	query, args, clause := countriesQuery, []interface{}{summary.RecoveriesAsOf, summary.AsOf, summary.AsOf}, " and "
+	if byProvince {
+		query, args, clause = provincesQuery, []interface{}{summary.AsOf, summary.RecoveriesAsOf, summary.AsOf}, " where "
+	}
+
+	if regionFilter != "" {
+		regionFilter = clause + regionFilter
+	}
+
+	totals := summaryTotals{}
+
+	rows, err := s.reads.Query(fmt.Sprintf(query, regionFilter), append(args, regionArgs...)...)
+
+	if err != nil {
+		return nil, totals, err
+	}
+	defer rows.Close()
+
+	list := []LocationStats{}
+
+	for rows.Next() {
+		locationStats := LocationStats{}
+		var locationPopulation sql.NullInt64
+		var daily dailyReportTotals
+
+		err := rows.Scan(
+			&locationStats.Country.Name,
+			&locationStats.Country.Slug,
+			&locationStats.Country.ISO2,
+			&locationStats.Country.ISO3,
+			&locationStats.Country.Continent,
+			&locationStats.Country.WHORegion,
+			&locationStats.Province,
+			&locationStats.Confirmed,
+			&locationStats.NewConfirmed,
+			&locationStats.Deaths,
+			&locationStats.NewDeaths,
+			&locationStats.Recoveries,
+			&locationStats.NewRecoveries,
+			&locationPopulation,
+			&daily.active,
+			scanTime{&daily.lastUpdate},
+			&daily.ratedConfirmed,
+			&daily.ratedPopulation,
+		)
+
+		if err != nil {
+			return nil, totals, err
+		}
+
+		locationStats.ProvinceSlug = generateProvinceSlug(locationStats.Province)
+
+		if locationPopulation.Valid {
+			locationStats.PerCapitaStats = newPerCapitaStats(locationStats.CovidStats, locationPopulation.Int64)
+			totals.population += locationPopulation.Int64
+		}
+
+		locationStats.DailyReportStats = daily.stats()
+		totals.daily.add(daily)
+
+		list = append(list, locationStats)
+	}
+
+	return list, totals, rows.Err()
+}
+
+func (s sqlStore) GetTimeSeries(countrySlug string, status string, q TimeSeriesQuery) (*TimeSeries, error) {
+	countrySlug, err := s.canonicalSlug(countrySlug)
+	if err != nil {
+		return nil, err
+	}
+
+	timeSeries, err := s.timeSeries(countrySlug, nil, nil, status, q)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(timeSeries.DataPoints) == 0 {
+		if err := s.checkCountry(countrySlug); err != nil {
+			return nil, err
+		}
+	}
+
+	return timeSeries, nil
+}
+
+// GetProvinceTimeSeries returns the time series of a single province of a country.
+func (s sqlStore) GetProvinceTimeSeries(countrySlug string, provinceSlug string, status string, q TimeSeriesQuery) (*TimeSeries, error) {
+	provinces, err := s.GetProvinces(countrySlug)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, province := range provinces {
+		if province.Slug == strings.ToLower(provinceSlug) {
+			return s.timeSeries(province.Country.Slug, &province.Name, nil, status, q)
+		}
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrUnknownProvince, provinceSlug)
+}
+
+// timeSeries returns the time series of every location of countrySlug, or only of province if it is not nil.
+// It returns the series of county instead when it is not nil, which requires province.
+func (s sqlStore) timeSeries(countrySlug string, province *string, county *string, status string, q TimeSeriesQuery) (*TimeSeries, error) {
+	columns, err := columnsFor(status)
+	if err != nil {
+		return nil, err
+	}
+
+	location := func(table string) string {
+		condition := table + "country_slug = ?"
+		if province != nil {
+			condition += " and " + table + "province = ?"
+		}
+		if county != nil {
+			return condition + " and " + table + "county = ?"
+		}
+		return condition + " and " + table + "county = ''"
+	}
+
+	locationArgs := []interface{}{countrySlug}
+	if province != nil {
+		locationArgs = append(locationArgs, *province)
+	}
+	if county != nil {
+		locationArgs = append(locationArgs, *county)
+	}
+
+	filter, filterArgs := q.filter("t.date_recorded")
+	args := []interface{}{}
+
+	query := fmt.Sprintf(`
+	select t.country,t.country_slug,t.province,t.county,COALESCE(cy.fips,''),t.%s,t.%s,t.latitude,t.longitude,t.date_recorded,
+	COALESCE(cy.population,p.population)
+	from %s t
+	left join population p on p.country_slug = t.country_slug and p.province = t.province and t.county = ''
+	left join counties cy on cy.country_slug = t.country_slug and cy.province = t.province and cy.county = t.county
+	`, columns.amount, columns.new, columns.table)
+
+	if q.Limit > 0 {
+		limitFilter, limitArgs := q.filter("date_recorded")
+
+		query += fmt.Sprintf(`
+		join (
+			select distinct date_recorded from %s where %s%s order by date_recorded %s limit ?
+		) d on d.date_recorded = t.date_recorded
+		`, columns.table, location(""), limitFilter, q.direction())
+
+		args = append(args, locationArgs...)
+		args = append(args, limitArgs...)
+		args = append(args, q.Limit)
+	}
+
+	query += fmt.Sprintf(`where %s%s order by t.date_recorded %s, t.province, t.county`, location("t."), filter, q.direction())
+	args = append(args, locationArgs...)
+	args = append(args, filterArgs...)
+
+	rows, err := s.reads.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	timeSeries := new(TimeSeries)
+
+	for rows.Next() {
+		dataPoint := TimeSeriesDataPoint{}
+		var population sql.NullInt64
+
+		err = rows.Scan(
+			&dataPoint.Country.Name,
+			&dataPoint.Country.Slug,
+			&dataPoint.Province,
+			&dataPoint.County,
+			&dataPoint.FIPS,
+			&dataPoint.Amount,
+			&dataPoint.New,
+			&dataPoint.Latitude,
+			&dataPoint.Longitude,
+			&dataPoint.Date,
+			&population,
+		)
+
+		dataPoint.Status = status
+
+		if err != nil {
+			return nil, err
+		}
+
+		dataPoint.ProvinceSlug = generateProvinceSlug(dataPoint.Province)
+		dataPoint.CountySlug = generateCountySlug(dataPoint.County)
+
+		if q.PerCapita && population.Valid {
+			dataPoint.setPopulation(population.Int64)
+		}
+
+		timeSeries.DataPoints = append(timeSeries.DataPoints, dataPoint)
+	}
+
+	return timeSeries, rows.Err()
+}
+
+// GetProvinces lists the provinces of a country found in either time series table, which is
+// empty for a country that is only reported as a whole.
+func (s sqlStore) GetProvinces(countrySlug string) ([]Province, error) {
+	countrySlug, err := s.canonicalSlug(countrySlug)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkCountry(countrySlug); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.reads.Query(`
+	select country, country_slug, province from confirmed_and_deaths_time_series where country_slug = ? and province <> '' and county = ''
+	union
+	select country, country_slug, province from recoveries_time_series where country_slug = ? and province <> '' and county = ''
+	order by province
+	`, countrySlug, countrySlug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	provinces := []Province{}
+	seen := make(map[string]bool)
+
+	for rows.Next() {
+		province := Province{}
+
+		if err := rows.Scan(&province.Country.Name, &province.Country.Slug, &province.Name); err != nil {
+			return nil, err
+		}
+
+		if seen[province.Name] {
+			continue
+		}
+		seen[province.Name] = true
+
+		province.Slug = generateProvinceSlug(province.Name)
+		provinces = append(provinces, province)
+	}
+
+	return provinces, rows.Err()
+}
+
+// GetCounties lists the counties of a country, or only those of the province provinceSlug when it is
+// not empty. Counties are only reported for the US.
+func (s sqlStore) GetCounties(countrySlug string, provinceSlug string) ([]County, error) {
+	countrySlug, err := s.canonicalSlug(countrySlug)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkCountry(countrySlug); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.reads.Query(`
+	select country, country_slug, province, county, fips, population from counties where country_slug = ?
+	order by province, county
+	`, countrySlug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counties := []County{}
+
+	for rows.Next() {
+		county := County{}
+		var population sql.NullInt64
+
+		err := rows.Scan(
+			&county.Country.Name,
+			&county.Country.Slug,
+			&county.Province.Name,
+			&county.Name,
+			&county.FIPS,
+			&population,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		county.Province.Slug = generateProvinceSlug(county.Province.Name)
+		if provinceSlug != "" && county.Province.Slug != strings.ToLower(provinceSlug) {
+			continue
+		}
+
+		county.Slug = generateCountySlug(county.Name)
+		if population.Valid {
+			county.Population = &population.Int64
+		}
+
+		counties = append(counties, county)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(counties) == 0 && provinceSlug != "" {
+		return nil, fmt.Errorf("%w %q", ErrUnknownProvince, provinceSlug)
+	}
+
+	return counties, nil
+}
+
+// GetCountyTimeSeries returns the time series of a single county of a province.
+func (s sqlStore) GetCountyTimeSeries(countrySlug string, provinceSlug string, countySlug string, status string, q TimeSeriesQuery) (*TimeSeries, error) {
+	counties, err := s.GetCounties(countrySlug, provinceSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, county := range counties {
+		if county.Slug == strings.ToLower(countySlug) {
+			return s.timeSeries(county.Country.Slug, &county.Province.Name, &county.Name, status, q)
+		}
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrUnknownCounty, countySlug)
+}
+
+func (s sqlStore) GetAggTimeSeries(countrySlug string, status string, q TimeSeriesQuery) (*TimeSeries, error) {
+	columns, err := columnsFor(status)
+	if err != nil {
+		return nil, err
+	}
+
+	countrySlug, err = s.canonicalSlug(countrySlug)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, filterArgs := q.filter("date_recorded")
+	args := append([]interface{}{countrySlug}, filterArgs...)
+
+	query := fmt.Sprintf(`
+	select country,country_slug,%s,%s,date_recorded
+	from daily_country_summary where country_slug = ? and %s is not null%s order by date_recorded %s
+	`, columns.amount, columns.new, columns.amount, filter, q.direction())
+
+	if q.Limit > 0 {
+		query += " limit ?"
+		args = append(args, q.Limit)
+	}
+
+	var population sql.NullInt64
+	if q.PerCapita {
+		err := s.reads.QueryRow(`select population from population where country_slug = ? and province = ''`, countrySlug).Scan(&population)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	rows, err := s.reads.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	timeSeries := new(TimeSeries)
+
+	for rows.Next() {
+		dataPoint := TimeSeriesDataPoint{}
+
+		err = rows.Scan(
+			&dataPoint.Country.Name,
+			&dataPoint.Country.Slug,
+			&dataPoint.Amount,
+			&dataPoint.New,
+			&dataPoint.Date,
+		)
+
+		dataPoint.Status = status
+
+		if err != nil {
+			return nil, err
+		}
+
+		if population.Valid {
+			dataPoint.setPopulation(population.Int64)
+		}
+
+		timeSeries.DataPoints = append(timeSeries.DataPoints, dataPoint)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(timeSeries.DataPoints) == 0 {
+		if err := s.checkCountry(countrySlug); err != nil {
+			return nil, err
+		}
+	}
+
+	return timeSeries, nil
+}
+
+func (s sqlStore) GetIngestRuns(limit int) ([]IngestRun, error) {
+	rows, err := s.reads.Query(`
+	select id,series,source,started_at,finished_at,rows_read,rows_inserted,rows_updated,rows_skipped,first_date,last_date,error
+	from ingest_runs order by started_at desc, id desc limit ?
+	`, limit)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []IngestRun{}
+
+	for rows.Next() {
+		run := IngestRun{}
+		var runErr sql.NullString
+
+		err := rows.Scan(
+			&run.ID,
+			&run.Series,
+			&run.Source,
+			&run.StartedAt,
+			&run.FinishedAt,
+			&run.RowsRead,
+			&run.RowsInserted,
+			&run.RowsUpdated,
+			&run.RowsSkipped,
+			&run.FirstDate,
+			&run.LastDate,
+			&runErr,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		run.Error = runErr.String
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+func (s sqlStore) GetLastIngest() (time.Time, error) {
+	var lastIngest time.Time
+
+	err := s.reads.QueryRow(`select MAX(finished_at) from ingest_runs where error is null`).Scan(scanTime{&lastIngest})
+	return lastIngest, err
+}
+
+func (s sqlStore) CreateSubscription(sub *Subscription) error {
+	countrySlug, err := s.subscribedCountry(sub.CountrySlug)
+	if err != nil {
+		return err
+	}
+
+	sub.CountrySlug = countrySlug
+	sub.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	res, err := s.db.Exec(`
+	insert into subscriptions (url,secret,country_slug,metric,rule,threshold,created_at) values (?,?,?,?,?,?,?)
+	`, sub.URL, sub.Secret, sub.CountrySlug, sub.Metric, sub.Rule, sub.Threshold, sub.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	sub.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s sqlStore) GetSubscriptions() ([]Subscription, error) {
+	rows, err := s.reads.Query(`
+	select id,url,secret,country_slug,metric,rule,threshold,created_at from subscriptions order by id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []Subscription{}
+
+	for rows.Next() {
+		sub := Subscription{}
+
+		err := rows.Scan(&sub.ID, &sub.URL, &sub.Secret, &sub.CountrySlug, &sub.Metric, &sub.Rule, &sub.Threshold, scanTime{&sub.CreatedAt})
+		if err != nil {
+			return nil, err
+		}
+
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+func (s sqlStore) GetSubscription(id int64) (*Subscription, error) {
+	sub := &Subscription{}
+
+	err := s.reads.QueryRow(`
+	select id,url,secret,country_slug,metric,rule,threshold,created_at from subscriptions where id = ?
+	`, id).Scan(&sub.ID, &sub.URL, &sub.Secret, &sub.CountrySlug, &sub.Metric, &sub.Rule, &sub.Threshold, scanTime{&sub.CreatedAt})
+
+	if err == sql.ErrNoRows {
+		return nil, ErrUnknownSubscription
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (s sqlStore) UpdateSubscription(sub *Subscription) error {
+	stored, err := s.GetSubscription(sub.ID)
+	if err != nil {
+		return err
+	}
+
+	countrySlug, err := s.subscribedCountry(sub.CountrySlug)
+	if err != nil {
+		return err
+	}
+
+	sub.CountrySlug = countrySlug
+	sub.CreatedAt = stored.CreatedAt
+
+	_, err = s.db.Exec(`
+	update subscriptions set url = ?, secret = ?, country_slug = ?, metric = ?, rule = ?, threshold = ? where id = ?
+	`, sub.URL, sub.Secret, sub.CountrySlug, sub.Metric, sub.Rule, sub.Threshold, sub.ID)
+	return err
+}
+
+func (s sqlStore) DeleteSubscription(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`delete from subscriptions where id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUnknownSubscription
+	}
+
+	if _, err := tx.Exec(`delete from webhook_deliveries where subscription_id = ?`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// subscribedCountry resolves the country slug of a subscription, which must have data.
+func (s sqlStore) subscribedCountry(countrySlug string) (string, error) {
+	countrySlug, err := s.canonicalSlug(countrySlug)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.checkCountry(countrySlug); err != nil {
+		return "", err
+	}
+	return countrySlug, nil
+}
+
+func (s sqlStore) RecordDelivery(d *Delivery) error {
+	res, err := s.db.Exec(`
+	insert into webhook_deliveries (subscription_id,date_reported,attempt,status_code,error,payload,attempted_at) values (?,?,?,?,?,?,?)
+	`, d.SubscriptionID, d.Date, d.Attempt, d.StatusCode, nullString(d.Error), string(d.Payload), d.AttemptedAt)
+	if err != nil {
+		return err
+	}
+
+	d.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s sqlStore) GetDeliveries(subscriptionID int64, limit int) ([]Delivery, error) {
+	if _, err := s.GetSubscription(subscriptionID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.reads.Query(`
+	select id,subscription_id,date_reported,attempt,status_code,error,payload,attempted_at
+	from webhook_deliveries where subscription_id = ? order by attempted_at desc, id desc limit ?
+	`, subscriptionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+
+	for rows.Next() {
+		d := Delivery{}
+		var statusCode sql.NullInt64
+		var deliveryErr sql.NullString
+		var payload string
+
+		err := rows.Scan(&d.ID, &d.SubscriptionID, scanTime{&d.Date}, &d.Attempt, &statusCode, &deliveryErr, &payload, scanTime{&d.AttemptedAt})
+		if err != nil {
+			return nil, err
+		}
+
+		if statusCode.Valid {
+			code := int(statusCode.Int64)
+			d.StatusCode = &code
+		}
+		d.Error = deliveryErr.String
+		d.Payload = json.RawMessage(payload)
+
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// summaryDates picks the dates a summary is computed for: date for every table when it is set,
+// or else the latest complete date of each table. It returns ErrNoData when there is nothing to summarize.
+func (s sqlStore) summaryDates(date time.Time, confirmedAndDeaths *time.Time, recoveries *time.Time) error {
+	if date.IsZero() {
+		if err := s.latestDates(confirmedAndDeaths, recoveries); err != nil {
+			return err
+		}
+		if confirmedAndDeaths.IsZero() {
+			return ErrNoData
+		}
+		return nil
+	}
+
+	var found int
+	err := s.reads.QueryRow(`
+	select COUNT(*) from (select 1 from confirmed_and_deaths_time_series where date_recorded = ? and county = '' limit 1) d
+	`, date).Scan(&found)
+
+	if err != nil {
+		return err
+	}
+	if found == 0 {
+		return ErrNoData
+	}
+
+	*confirmedAndDeaths = date
+	*recoveries = date
+	return nil
+}
+
+// latestDates reads the latest complete dates of the time series tables recorded by the collector.
+// A table that has not been ingested yet leaves its date zero.
+func (s sqlStore) latestDates(confirmedAndDeaths *time.Time, recoveries *time.Time) error {
+	rows, err := s.reads.Query(`select table_name, latest_date from ingest_metadata`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table string
+		var latest time.Time
+
+		if err := rows.Scan(&table, scanTime{&latest}); err != nil {
+			return err
+		}
+
+		switch table {
+		case confirmedAndDeathsTable:
+			*confirmedAndDeaths = latest
+		case recoveriesTable:
+			*recoveries = latest
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s sqlStore) Close() error {
+	if s.reads != s.db {
+		if err := s.reads.Close(); err != nil {
+			s.db.Close()
+			return err
+		}
+	}
+	return s.db.Close()
+}
+
+// scanTime scans a date into t. Drivers return dates computed by an aggregate such as
+// MAX(date_recorded) as text when the database has no date type, as SQLite does.
+type scanTime struct {
+	t *time.Time
+}
+
+var scanTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05.999999999-07:00",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func (st scanTime) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case time.Time:
+		*st.t = v
+		return nil
+	case []byte:
+		return st.Scan(string(v))
+	case string:
+		for _, layout := range scanTimeLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				*st.t = t.UTC()
+				return nil
+			}
+		}
+		return fmt.Errorf("cannot parse %q as a date", v)
+	case nil:
+		*st.t = time.Time{}
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into a date", src)
+}
+
+// GetComparison sums up the time series of each country in countrySlugs in a single query. Its dates are
+// every date any of the countries has data for, and q.Limit applies to those dates. Aliases of the same
+// country are compared once.
+func (s sqlStore) GetComparison(countrySlugs []string, status string, q TimeSeriesQuery) (*Comparison, error) {
+	columns, err := columnsFor(status)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := []string{}
+	seen := make(map[string]bool)
+
+	for _, slug := range countrySlugs {
+		slug, err := s.canonicalSlug(slug)
+		if err != nil {
+			return nil, err
+		}
+
+		if !seen[slug] {
+			resolved = append(resolved, slug)
+			seen[slug] = true
+		}
+	}
+	countrySlugs = resolved
+
+	slugArgs := make([]interface{}, len(countrySlugs))
+	for i, slug := range countrySlugs {
+		slugArgs[i] = slug
+	}
+
+	filter, filterArgs := q.filter("t.date_recorded")
+	args := []interface{}{}
+
+	query := fmt.Sprintf(`
+	select t.country,t.country_slug,SUM(t.%s),SUM(t.%s),t.date_recorded
+	from %s t
+	`, columns.amount, columns.new, columns.table)
+
+	if q.Limit > 0 {
+		limitFilter, limitArgs := q.filter("date_recorded")
+
+		query += fmt.Sprintf(`
+		join (
+			select distinct date_recorded from %s where country_slug in (%s) and county = ''%s order by date_recorded %s limit ?
+		) d on d.date_recorded = t.date_recorded
+		`, columns.table, placeholders(len(countrySlugs)), limitFilter, q.direction())
+
+		args = append(args, slugArgs...)
+		args = append(args, limitArgs...)
+		args = append(args, q.Limit)
+	}
+
+	query += fmt.Sprintf(`where t.country_slug in (%s) and t.county = ''%s
+	group by t.date_recorded,t.country_slug,t.country order by t.date_recorded %s`,
+		placeholders(len(countrySlugs)), filter, q.direction())
+	args = append(args, slugArgs...)
+	args = append(args, filterArgs...)
+
+	rows, err := s.reads.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comparison := &Comparison{Status: status, Dates: []time.Time{}, Countries: make([]ComparisonSeries, len(countrySlugs))}
+
+	series := make(map[string]*ComparisonSeries, len(countrySlugs))
+	for i, slug := range countrySlugs {
+		comparison.Countries[i].Slug = slug
+		series[slug] = &comparison.Countries[i]
+	}
+
+	for rows.Next() {
+		var country Country
+		var amount, newAmount int64
+		var date time.Time
+
+		if err := rows.Scan(&country.Name, &country.Slug, &amount, &newAmount, &date); err != nil {
+			return nil, err
+		}
+
+		if n := len(comparison.Dates); n == 0 || !comparison.Dates[n-1].Equal(date) {
+			comparison.Dates = append(comparison.Dates, date)
+			for i := range comparison.Countries {
+				comparison.Countries[i].Amounts = append(comparison.Countries[i].Amounts, nil)
+				comparison.Countries[i].New = append(comparison.Countries[i].New, nil)
+			}
+		}
+
+		cs, ok := series[country.Slug]
+		if !ok {
+			continue
+		}
+
+		i := len(comparison.Dates) - 1
+		cs.Country = country
+		cs.Amounts[i] = &amount
+		cs.New[i] = &newAmount
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, cs := range comparison.Countries {
+		if cs.Name == "" {
+			if err := s.checkCountry(cs.Slug); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return comparison, nil
+}
+
+// GetRegionTimeSeries sums up the time series of the member countries of region.
+func (s sqlStore) GetRegionTimeSeries(regionSlug string, status string, q TimeSeriesQuery) (*TimeSeries, error) {
+	columns, err := columnsFor(status)
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := findRegion(regionSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	column, value := region.filter()
+
+	filter, filterArgs := q.filter("t.date_recorded")
+	args := append([]interface{}{value}, filterArgs...)
+
+	query := fmt.Sprintf(`
+	select SUM(t.%s),SUM(t.%s),t.date_recorded
+	from %s t join countries c on c.country_slug = t.country_slug
+	where c.%s = ? and t.county = ''%s group by t.date_recorded order by t.date_recorded %s
+	`, columns.amount, columns.new, columns.table, column, filter, q.direction())
+
+	if q.Limit > 0 {
+		query += " limit ?"
+		args = append(args, q.Limit)
+	}
+
+	var population sql.NullInt64
+	if q.PerCapita {
+		err := s.reads.QueryRow(fmt.Sprintf(`
+		select SUM(p.population) from population p join countries c on c.country_slug = p.country_slug
+		where p.province = '' and c.%s = ?
+		`, column), value).Scan(&population)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := s.reads.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	timeSeries := &TimeSeries{Region: region}
+
+	for rows.Next() {
+		dataPoint := TimeSeriesDataPoint{Status: status}
+
+		if err := rows.Scan(&dataPoint.Amount, &dataPoint.New, scanTime{&dataPoint.Date}); err != nil {
+			return nil, err
+		}
+
+		if population.Valid {
+			dataPoint.setPopulation(population.Int64)
+		}
+
+		timeSeries.DataPoints = append(timeSeries.DataPoints, dataPoint)
+	}
+
+	return timeSeries, rows.Err()
+}
+
+// canonicalSlug resolves an alias such as an old slug or an ISO 3166 code to the slug the time series are
+// stored under. Any other slug is returned as is.
+func (s sqlStore) canonicalSlug(countrySlug string) (string, error) {
+	countrySlug = strings.ToLower(countrySlug)
+
+	var canonical string
+
+	err := s.reads.QueryRow(`select country_slug from country_aliases where alias = ?`, countrySlug).Scan(&canonical)
+	if err == sql.ErrNoRows {
+		return countrySlug, nil
+	}
+	return canonical, err
+}
+
+// checkCountry returns an UnknownCountryError if neither table has data for countrySlug.
+func (s sqlStore) checkCountry(countrySlug string) error {
+	var exists bool
+
+	err := s.reads.QueryRow(`
+	select exists(select 1 from confirmed_and_deaths_time_series where country_slug = ?)
+	or exists(select 1 from recoveries_time_series where country_slug = ?)
+	`, countrySlug, countrySlug).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return &UnknownCountryError{Slug: countrySlug}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+type sqliteDialect struct{}
+
+// sqliteReaders is the number of connections that read a SQLite file at the same time.
+const sqliteReaders = 4
+
+// NewSqlite opens the SQLite database at path, creating the file if needed. Its tables are
+// created by MigrateUp. Use ":memory:" for a database that only lives as long as the returned Service.
+func NewSqlite(path string) (Service, error) {
+	if path == ":memory:" {
+		// Every connection to ":memory:" is a separate database, so all queries share one connection.
+		db, err := sql.Open("sqlite", path)
+		if err != nil {
+			return nil, err
+		}
+		db.SetMaxOpenConns(1)
+
+		return sqlStore{db, db, sqliteDialect{}}, db.Ping()
+	}
+
+	// In WAL mode readers do not wait for the writer, so queries keep being answered while the
+	// collector holds a long transaction. SQLite still allows a single writer at a time, so writes
+	// share one connection, and the busy timeout covers the checkpoints that briefly lock the file.
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	dsn := path + separator + "_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	reads, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	reads.SetMaxOpenConns(sqliteReaders)
+
+	return sqlStore{db, reads, sqliteDialect{}}, reads.Ping()
+}
+
+func (sqliteDialect) name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) upsert(table string, columns []string, key []string, update []string) string {
+	assignments := make([]string, len(update))
+	for i, column := range update {
+		assignments[i] = fmt.Sprintf("%s = excluded.%s", column, column)
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s",
+		table, strings.Join(columns, ","), placeholders(len(columns)), strings.Join(key, ","), strings.Join(assignments, ", "))
+}
@@ -0,0 +1,1283 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testConfirmed = "Province/State,Country/Region,Lat,Long,1/22/20,1/23/20,1/24/20\n" +
+		"Ontario,Canada,51.25,-85.32,1,3,6\n" +
+		"Quebec,Canada,52.94,-73.55,0,2,2\n" +
+		",France,46.23,2.21,2,4,9\n" +
+		",Italy,41.87,12.57,0,1,5\n"
+	testDeaths = "Province/State,Country/Region,Lat,Long,1/22/20,1/23/20,1/24/20\n" +
+		",Italy,41.87,12.57,0,0,1\n" +
+		"Quebec,Canada,52.94,-73.55,0,0,1\n" +
+		"Ontario,Canada,51.25,-85.32,0,0,0\n" +
+		",France,46.23,2.21,0,1,1\n"
+	testRecoveries = "Province/State,Country/Region,Lat,Long,1/22/20,1/23/20,1/24/20\n" +
+		",Canada,56.13,-106.35,0,1,2\n" +
+		",France,46.23,2.21,0,0,3\n" +
+		",Italy,41.87,12.57,0,0,0\n"
+)
+
+func newTestStore(t *testing.T) Service {
+	t.Helper()
+
+	st, err := NewSqlite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	if _, err := MigrateUp(st); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SeedReferenceData(st); err != nil {
+		t.Fatal(err)
+	}
+
+	return st
+}
+
+func ingest(t *testing.T, st Service, src Source) {
+	t.Helper()
+
+	collector, err := NewJhuCsseDataCollector(st, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := collector.UpdateConfirmedAndDeaths(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collector.UpdateRecoveries(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testSource() MemSource {
+	return MemSource{
+		ConfirmedGlobalSeries:  []byte(testConfirmed),
+		DeathsGlobalSeries:     []byte(testDeaths),
+		RecoveriesGlobalSeries: []byte(testRecoveries),
+	}
+}
+
+func TestSqliteFileReadsDuringWrite(t *testing.T) {
+	st, err := NewSqlite(filepath.Join(t.TempDir(), "covid19.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	if _, err := MigrateUp(st); err != nil {
+		t.Fatal(err)
+	}
+	ingest(t, st, testSource())
+
+	db, err := st.GetDbInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mode string
+	if err := db.QueryRow(`pragma journal_mode`).Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal_mode = %q; want wal", mode)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`update confirmed_and_deaths_time_series set confirmed_cases = 0`); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := st.GetCountries()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetCountries() waited for the write transaction")
+	}
+}
+
+func TestSqliteSummary(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	summary, err := st.GetSummary(SummaryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(summary.LocationStatsList), 3; got != want {
+		t.Fatalf("len(LocationStatsList) = %d; want %d", got, want)
+	}
+
+	want := CovidStats{Confirmed: 22, NewConfirmed: 12, Deaths: 3, NewDeaths: 2, Recoveries: 5, NewRecoveries: 4}
+	if got := summary.CovidStats; got != want {
+		t.Errorf("GetSummary() totals = %+v; want %+v", got, want)
+	}
+
+	asOf := time.Date(2020, 1, 24, 0, 0, 0, 0, time.UTC)
+	if !summary.AsOf.Equal(asOf) || !summary.RecoveriesAsOf.Equal(asOf) {
+		t.Errorf("GetSummary() as of %v and %v; want %v", summary.AsOf, summary.RecoveriesAsOf, asOf)
+	}
+
+	global, err := st.GetGlobalStats(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := global.CovidStats; got != want {
+		t.Errorf("GetGlobalStats() = %+v; want %+v", got, want)
+	}
+}
+
+func TestSqliteSummaryOnDate(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	date := time.Date(2020, 1, 23, 0, 0, 0, 0, time.UTC)
+
+	summary, err := st.GetSummary(SummaryQuery{Date: date})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := CovidStats{Confirmed: 10, NewConfirmed: 7, Deaths: 1, NewDeaths: 1, Recoveries: 1, NewRecoveries: 1}
+	if got := summary.CovidStats; got != want {
+		t.Errorf("GetSummary() totals on %v = %+v; want %+v", date, got, want)
+	}
+
+	if !summary.AsOf.Equal(date) {
+		t.Errorf("GetSummary() as of %v; want %v", summary.AsOf, date)
+	}
+
+	_, err = st.GetGlobalStats(time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC))
+	if !errors.Is(err, ErrNoData) {
+		t.Errorf("GetGlobalStats() error before the first date = %v; want ErrNoData", err)
+	}
+}
+
+func TestSqliteSummaryWithoutFrance(t *testing.T) {
+	st := newTestStore(t)
+
+	src := testSource()
+	for name, series := range src {
+		src[name] = []byte(strings.Replace(string(series), "France", "Germany", 1))
+	}
+	ingest(t, st, src)
+
+	summary, err := st.GetSummary(SummaryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(summary.LocationStatsList), 3; got != want {
+		t.Errorf("len(LocationStatsList) = %d; want %d", got, want)
+	}
+}
+
+func TestSqliteTimeSeries(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	timeSeries, err := st.GetTimeSeries("canada", Deaths, TimeSeriesQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(timeSeries.DataPoints), 6; got != want {
+		t.Fatalf("len(DataPoints) = %d; want %d", got, want)
+	}
+
+	last := timeSeries.DataPoints[5]
+	if last.Province != "Quebec" || last.Amount != 1 || last.New != 1 {
+		t.Errorf("last data point = %+v; want Quebec with 1 death", last)
+	}
+
+	timeSeries, err = st.GetTimeSeries("canada", Confirmed, TimeSeriesQuery{Limit: 1, Order: Descending})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(timeSeries.DataPoints), 2; got != want {
+		t.Fatalf("len(DataPoints) with a limit of 1 date = %d; want %d", got, want)
+	}
+
+	aggTimeSeries, err := st.GetAggTimeSeries("canada", Confirmed, TimeSeriesQuery{
+		From:  time.Date(2020, 1, 23, 0, 0, 0, 0, time.UTC),
+		Order: Descending,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(aggTimeSeries.DataPoints), 2; got != want {
+		t.Fatalf("len(DataPoints) from 2020-01-23 = %d; want %d", got, want)
+	}
+
+	if got, want := aggTimeSeries.DataPoints[0].Amount, int64(8); got != want {
+		t.Errorf("Amount on 2020-01-24 = %d; want %d", got, want)
+	}
+}
+
+func TestSqliteProvinces(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	provinces, err := st.GetProvinces("canada")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(provinces), 2; got != want {
+		t.Fatalf("len(GetProvinces()) = %d; want %d", got, want)
+	}
+
+	if got := provinces[0]; got.Name != "Ontario" || got.Slug != "ontario" || got.Country.Slug != "canada" {
+		t.Errorf("first province = %+v; want Ontario of Canada", got)
+	}
+
+	if _, err := st.GetProvinces("atlantis"); !errors.Is(err, ErrUnknownCountry) {
+		t.Errorf("GetProvinces() error = %v; want ErrUnknownCountry", err)
+	}
+
+	timeSeries, err := st.GetProvinceTimeSeries("canada", "quebec", Confirmed, TimeSeriesQuery{Order: Descending})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(timeSeries.DataPoints), 3; got != want {
+		t.Fatalf("len(DataPoints) = %d; want %d", got, want)
+	}
+
+	if got := timeSeries.DataPoints[0]; got.Province != "Quebec" || got.ProvinceSlug != "quebec" || got.Amount != 2 {
+		t.Errorf("first data point = %+v; want Quebec with 2 confirmed cases", got)
+	}
+
+	if _, err := st.GetProvinceTimeSeries("canada", "yukon", Confirmed, TimeSeriesQuery{}); !errors.Is(err, ErrUnknownProvince) {
+		t.Errorf("GetProvinceTimeSeries() error = %v; want ErrUnknownProvince", err)
+	}
+
+	summary, err := st.GetSummary(SummaryQuery{Provinces: true, Sort: "confirmed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(summary.LocationStatsList), 4; got != want {
+		t.Fatalf("len(LocationStatsList) by province = %d; want %d", got, want)
+	}
+
+	if got := summary.LocationStatsList[1]; got.ProvinceSlug != "ontario" || got.Confirmed != 6 {
+		t.Errorf("second location = %+v; want Ontario with 6 confirmed cases", got)
+	}
+
+	want := CovidStats{Confirmed: 22, NewConfirmed: 12, Deaths: 3, NewDeaths: 2, Recoveries: 5, NewRecoveries: 4}
+	if got := summary.CovidStats; got != want {
+		t.Errorf("GetSummary() totals by province = %+v; want %+v", got, want)
+	}
+
+	// Without a sort, the provinces are listed by country and province.
+	summary, err = st.GetSummary(SummaryQuery{Provinces: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var locations []string
+	for _, location := range summary.LocationStatsList {
+		locations = append(locations, location.Slug+"/"+location.ProvinceSlug)
+	}
+
+	if want := []string{"canada/ontario", "canada/quebec", "france/", "italy/"}; !reflect.DeepEqual(locations, want) {
+		t.Errorf("locations by province = %v; want %v", locations, want)
+	}
+}
+
+func TestSqliteSummarySorted(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	slugs := func(q SummaryQuery) string {
+		t.Helper()
+
+		summary, err := st.GetSummary(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := []string{}
+		for _, locationStats := range summary.LocationStatsList {
+			got = append(got, locationStats.Country.Slug)
+		}
+		return strings.Join(got, ",")
+	}
+
+	for _, test := range []struct {
+		q    SummaryQuery
+		want string
+	}{
+		{SummaryQuery{Sort: "confirmed"}, "france,canada,italy"},
+		{SummaryQuery{Sort: "confirmed", Order: Ascending}, "italy,canada,france"},
+		{SummaryQuery{Sort: "newConfirmed", Limit: 1, Offset: 1}, "italy"},
+		{SummaryQuery{Sort: "newDeaths", MinConfirmed: 6}, "canada,france"},
+		{SummaryQuery{Offset: 5}, ""},
+	} {
+		if got := slugs(test.q); got != test.want {
+			t.Errorf("GetSummary(%+v) countries = %s; want %s", test.q, got, test.want)
+		}
+	}
+
+	summary, err := st.GetSummary(SummaryQuery{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := summary.Confirmed, int64(22); got != want {
+		t.Errorf("GetSummary() with a limit confirmed = %d; want %d", got, want)
+	}
+}
+
+func TestSqliteComparison(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	comparison, err := st.GetComparison([]string{"canada", "italy"}, Confirmed, TimeSeriesQuery{Limit: 2, Order: Descending})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(comparison.Dates), 2; got != want {
+		t.Fatalf("len(Dates) = %d; want %d", got, want)
+	}
+
+	if want := time.Date(2020, 1, 24, 0, 0, 0, 0, time.UTC); !comparison.Dates[0].Equal(want) {
+		t.Errorf("Dates[0] = %v; want %v", comparison.Dates[0], want)
+	}
+
+	if got, want := len(comparison.Countries), 2; got != want {
+		t.Fatalf("len(Countries) = %d; want %d", got, want)
+	}
+
+	canada, italy := comparison.Countries[0], comparison.Countries[1]
+
+	if canada.Name != "Canada" || *canada.Amounts[0] != 8 || *canada.New[0] != 3 {
+		t.Errorf("Canada on 2020-01-24 = %s %d %d; want Canada 8 3", canada.Name, *canada.Amounts[0], *canada.New[0])
+	}
+
+	if *italy.Amounts[1] != 1 {
+		t.Errorf("Italy on 2020-01-23 = %d; want 1", *italy.Amounts[1])
+	}
+
+	comparison, err = st.GetComparison([]string{"canada", "france"}, Confirmed, TimeSeriesQuery{From: time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(comparison.Dates); got != 0 {
+		t.Errorf("len(Dates) after the last date = %d; want 0", got)
+	}
+
+	_, err = st.GetComparison([]string{"canada", "atlantis"}, Confirmed, TimeSeriesQuery{})
+
+	var unknownCountry *UnknownCountryError
+	if !errors.As(err, &unknownCountry) || unknownCountry.Slug != "atlantis" {
+		t.Errorf("GetComparison() error with an unknown country = %v; want UnknownCountryError for atlantis", err)
+	}
+}
+
+func TestSqliteUnknownCountry(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	if _, err := st.GetTimeSeries("atlantis", Confirmed, TimeSeriesQuery{}); !errors.Is(err, ErrUnknownCountry) {
+		t.Errorf("GetTimeSeries() error = %v; want ErrUnknownCountry", err)
+	}
+
+	if _, err := st.GetAggTimeSeries("atlantis", Recoveries, TimeSeriesQuery{}); !errors.Is(err, ErrUnknownCountry) {
+		t.Errorf("GetAggTimeSeries() error = %v; want ErrUnknownCountry", err)
+	}
+
+	timeSeries, err := st.GetAggTimeSeries("italy", Deaths, TimeSeriesQuery{To: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("GetAggTimeSeries() error before the first date = %v; want nil", err)
+	}
+
+	if got := len(timeSeries.DataPoints); got != 0 {
+		t.Errorf("len(DataPoints) before the first date = %d; want 0", got)
+	}
+}
+
+func TestSqliteCountryAliases(t *testing.T) {
+	st := newTestStore(t)
+
+	src := testSource()
+	for name, series := range src {
+		src[name] = []byte(strings.Replace(string(series), ",Italy,", ",\"Korea, South\",", -1))
+	}
+	ingest(t, st, src)
+
+	for _, slug := range []string{"south-korea", "korea-south", "KR", "kor"} {
+		timeSeries, err := st.GetAggTimeSeries(slug, Confirmed, TimeSeriesQuery{})
+		if err != nil {
+			t.Fatalf("GetAggTimeSeries(%s) error = %v", slug, err)
+		}
+
+		if got, want := timeSeries.DataPoints[0].Country, (Country{Name: "Korea, South", Slug: "south-korea"}); got != want {
+			t.Errorf("GetAggTimeSeries(%s) country = %+v; want %+v", slug, got, want)
+		}
+	}
+
+	comparison, err := st.GetComparison([]string{"ca", "can", "fr"}, Deaths, TimeSeriesQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(comparison.Countries), 2; got != want {
+		t.Errorf("len(Countries) comparing aliases of the same country = %d; want %d", got, want)
+	}
+}
+
+func TestSeedReferenceDataRenamesCountries(t *testing.T) {
+	st := newTestStore(t)
+
+	db, err := st.GetDbInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(`insert into recoveries_time_series (country, country_slug, recoveries, date_recorded) values ('Korea, South', 'korea-south', 1, ?)`,
+		time.Date(2020, 1, 22, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SeedReferenceData(st); err != nil {
+		t.Fatal(err)
+	}
+
+	countries, err := st.GetCountries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(countries) != 1 || countries[0].Slug != "south-korea" {
+		t.Errorf("GetCountries() = %+v; want south-korea", countries)
+	}
+}
+
+func TestSeedReferenceDataMergesRenamedCountries(t *testing.T) {
+	st := newTestStore(t)
+
+	db, err := st.GetDbInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day1 := time.Date(2020, 1, 22, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2020, 1, 23, 0, 0, 0, 0, time.UTC)
+
+	// Both slugs hold 1/22/20, and only the alias holds 1/23/20.
+	for _, row := range []struct {
+		slug  string
+		value int
+		date  time.Time
+	}{
+		{"south-korea", 1, day1},
+		{"korea-south", 7, day1},
+		{"korea-south", 2, day2},
+	} {
+		for _, table := range []string{confirmedAndDeathsTable, recoveriesTable} {
+			column := "confirmed_cases"
+			if table == recoveriesTable {
+				column = "recoveries"
+			}
+
+			_, err := db.Exec(`insert into `+table+` (country, country_slug, `+column+`, date_recorded) values ('Korea, South', ?, ?, ?)`,
+				row.slug, row.value, row.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	_, err = db.Exec(`insert into daily_reports (country, country_slug, date_reported, confirmed, active) values ('Korea, South', 'korea-south', ?, 2, 2)`, day2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(`insert into subscriptions (url, secret, country_slug, metric, rule, threshold, created_at)
+	values ('https://example.com', 'secret', 'korea-south', 'confirmed', 'above', 1, ?)`, day2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SeedReferenceData(st); err != nil {
+		t.Fatal(err)
+	}
+
+	ts, err := st.GetAggTimeSeries("south-korea", Confirmed, TimeSeriesQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var amounts []int64
+	for _, point := range ts.DataPoints {
+		amounts = append(amounts, point.Amount)
+	}
+
+	if want := []int64{1, 2}; !reflect.DeepEqual(amounts, want) {
+		t.Errorf("merged confirmed cases = %v; want %v", amounts, want)
+	}
+
+	var active int64
+	if err := db.QueryRow(`select SUM(active) from daily_country_summary where country_slug = 'south-korea'`).Scan(&active); err != nil {
+		t.Fatal(err)
+	}
+	if active != 2 {
+		t.Errorf("summarized active cases = %d; want 2", active)
+	}
+
+	for _, table := range []string{recoveriesTable, "daily_reports", "subscriptions"} {
+		var left int
+		if err := db.QueryRow(`select COUNT(*) from ` + table + ` where country_slug = 'korea-south'`).Scan(&left); err != nil {
+			t.Fatal(err)
+		}
+		if left != 0 {
+			t.Errorf("%d rows of %s left under the alias; want 0", left, table)
+		}
+	}
+}
+
+func TestSeedReferenceDataMovesAccentStrippedSlugs(t *testing.T) {
+	st := newTestStore(t)
+
+	db, err := st.GetDbInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day1 := time.Date(2020, 1, 22, 0, 0, 0, 0, time.UTC)
+
+	// Curaçao used to be stored as curaao.
+	_, err = db.Exec(`insert into `+confirmedAndDeathsTable+` (country, country_slug, confirmed_cases, date_recorded) values ('Curaçao', 'curaao', 3, ?)`, day1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(`insert into subscriptions (url, secret, country_slug, metric, rule, threshold, created_at)
+	values ('https://example.com', 'secret', 'curaao', 'confirmed', 'above', 1, ?)`, day1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SeedReferenceData(st); err != nil {
+		t.Fatal(err)
+	}
+
+	// The old slug still resolves to the country.
+	for _, slug := range []string{"curacao", "curaao"} {
+		ts, err := st.GetAggTimeSeries(slug, Confirmed, TimeSeriesQuery{})
+		if err != nil {
+			t.Fatalf("GetAggTimeSeries(%q): %v", slug, err)
+		}
+
+		if len(ts.DataPoints) != 1 || ts.DataPoints[0].Amount != 3 {
+			t.Errorf("GetAggTimeSeries(%q).DataPoints = %+v; want 3 confirmed cases", slug, ts.DataPoints)
+		}
+	}
+
+	for _, table := range []string{confirmedAndDeathsTable, dailyCountrySummaryTable, "subscriptions"} {
+		var left int
+		if err := db.QueryRow(`select COUNT(*) from ` + table + ` where country_slug = 'curaao'`).Scan(&left); err != nil {
+			t.Fatal(err)
+		}
+		if left != 0 {
+			t.Errorf("%d rows of %s left under the accent-stripped slug; want 0", left, table)
+		}
+	}
+}
+
+func TestSqliteRegions(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	countries, err := st.GetCountries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Country{Name: "Canada", Slug: "canada", ISO2: "CA", ISO3: "CAN", Continent: "North America", WHORegion: "AMRO"}
+	if countries[0] != want {
+		t.Errorf("GetCountries()[0] = %+v; want %+v", countries[0], want)
+	}
+
+	summary, err := st.GetSummary(SummaryQuery{Region: "europe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(summary.LocationStatsList), 2; got != want {
+		t.Errorf("len(LocationStatsList) in europe = %d; want %d", got, want)
+	}
+
+	if got, want := summary.Confirmed, int64(14); got != want {
+		t.Errorf("Confirmed in europe = %d; want %d", got, want)
+	}
+
+	if summary.Region == nil || summary.Region.Name != "Europe" {
+		t.Errorf("Region = %+v; want Europe", summary.Region)
+	}
+
+	timeSeries, err := st.GetRegionTimeSeries("EURO", Deaths, TimeSeriesQuery{Order: Descending, Limit: 1, PerCapita: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(timeSeries.DataPoints), 1; got != want {
+		t.Fatalf("len(DataPoints) = %d; want %d", got, want)
+	}
+
+	last := timeSeries.DataPoints[0]
+	if last.Amount != 2 || last.New != 1 || !last.Date.Equal(time.Date(2020, 1, 24, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("last data point = %+v; want 2 deaths and 1 new on 2020-01-24", last)
+	}
+
+	if last.Population == nil {
+		t.Errorf("last data point has no population")
+	}
+
+	if _, err := st.GetRegionTimeSeries("atlantis", Deaths, TimeSeriesQuery{}); !errors.Is(err, ErrUnknownRegion) {
+		t.Errorf("GetRegionTimeSeries() error = %v; want ErrUnknownRegion", err)
+	}
+
+	if _, err := st.GetSummary(SummaryQuery{Region: "atlantis"}); !errors.Is(err, ErrUnknownRegion) {
+		t.Errorf("GetSummary() error = %v; want ErrUnknownRegion", err)
+	}
+}
+
+func TestSqlitePerCapita(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	summary, err := st.GetSummary(SummaryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, locationStats := range summary.LocationStatsList {
+		if locationStats.Population == nil || locationStats.ConfirmedPer100k == nil {
+			t.Fatalf("%s has no per-capita stats", locationStats.Country.Slug)
+		}
+
+		want := float64(locationStats.Confirmed) * 100000 / float64(*locationStats.Population)
+		if got := *locationStats.ConfirmedPer100k; got != want {
+			t.Errorf("%s ConfirmedPer100k = %v; want %v", locationStats.Country.Slug, got, want)
+		}
+	}
+
+	if summary.Population == nil {
+		t.Fatal("summary has no population")
+	}
+
+	timeSeries, err := st.GetTimeSeries("canada", Confirmed, TimeSeriesQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if timeSeries.DataPoints[0].Population != nil {
+		t.Errorf("data point has a population without PerCapita: %+v", timeSeries.DataPoints[0])
+	}
+
+	timeSeries, err = st.GetTimeSeries("canada", Confirmed, TimeSeriesQuery{PerCapita: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dataPoint := range timeSeries.DataPoints {
+		if dataPoint.Population == nil || dataPoint.AmountPer100k == nil {
+			t.Errorf("%s data point has no per-capita stats", dataPoint.Province)
+		}
+	}
+
+	aggTimeSeries, err := st.GetAggTimeSeries("canada", Confirmed, TimeSeriesQuery{PerCapita: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := aggTimeSeries.DataPoints[len(aggTimeSeries.DataPoints)-1]
+	if last.Population == nil || last.AmountPer100k == nil {
+		t.Fatalf("aggregated data point has no per-capita stats: %+v", last)
+	}
+
+	if got, want := *last.AmountPer100k, float64(8)*100000/float64(*last.Population); got != want {
+		t.Errorf("AmountPer100k = %v; want %v", got, want)
+	}
+}
+
+func TestSqliteIncrementalIngest(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	src := testSource()
+	src[ConfirmedGlobalSeries] = []byte("Province/State,Country/Region,Lat,Long,1/22/20,1/23/20,1/24/20,1/25/20\n" +
+		"Ontario,Canada,51.25,-85.32,1,3,6,7\n" +
+		"Quebec,Canada,52.94,-73.55,0,2,2,4\n" +
+		",France,46.23,2.21,2,4,9,9\n" +
+		",Italy,41.87,12.57,0,2,5,8\n")
+	src[DeathsGlobalSeries] = []byte("Province/State,Country/Region,Lat,Long,1/22/20,1/23/20,1/24/20,1/25/20\n" +
+		",Italy,41.87,12.57,0,0,1,1\n" +
+		"Quebec,Canada,52.94,-73.55,0,0,1,1\n" +
+		"Ontario,Canada,51.25,-85.32,0,0,0,0\n" +
+		",France,46.23,2.21,0,1,1,2\n")
+
+	collector, err := NewJhuCsseDataCollector(st, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hooked *IngestReport
+	collector.OnIngest(func(report *IngestReport) {
+		hooked = report
+	})
+
+	report, err := collector.UpdateConfirmedAndDeaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hooked != report {
+		t.Errorf("OnIngest hook called with %v; want the report of the update", hooked)
+	}
+
+	if got, want := report.Countries, []string{"canada", "france", "italy"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Countries = %v; want %v", got, want)
+	}
+
+	// Canada and France only gain 1/25/20 while Italy's revised 1/23/20 rewrites all of it.
+	if got, want := report.RowsInserted, 4; got != want {
+		t.Errorf("RowsInserted = %d; want %d", got, want)
+	}
+	if got, want := report.RowsUpdated, 3; got != want {
+		t.Errorf("RowsUpdated = %d; want %d", got, want)
+	}
+
+	runs, err := st.GetIngestRuns(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(runs), 3; got != want {
+		t.Fatalf("len(GetIngestRuns()) = %d; want %d", got, want)
+	}
+
+	if got, want := runs[0].RowsInserted, 4; got != want {
+		t.Errorf("latest run RowsInserted = %d; want %d", got, want)
+	}
+
+	if runs[0].LastDate == nil || !runs[0].LastDate.Equal(time.Date(2020, 1, 25, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("latest run LastDate = %v; want 2020-01-25", runs[0].LastDate)
+	}
+
+	lastIngest, err := st.GetLastIngest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !lastIngest.Equal(runs[0].FinishedAt) {
+		t.Errorf("GetLastIngest() = %v; want %v", lastIngest, runs[0].FinishedAt)
+	}
+}
+
+func TestSqliteRevisionKeepingSums(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	// A case of France moves from 1/23/20 to 1/22/20, which keeps the sum of its values.
+	src := testSource()
+	src[ConfirmedGlobalSeries] = []byte(strings.Replace(testConfirmed, ",France,46.23,2.21,2,4,9", ",France,46.23,2.21,3,3,9", 1))
+
+	collector, err := NewJhuCsseDataCollector(st, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := collector.UpdateConfirmedAndDeaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.RowsInserted != 0 || report.RowsUpdated != 3 {
+		t.Errorf("update inserted %d and updated %d rows; want 0 and 3", report.RowsInserted, report.RowsUpdated)
+	}
+
+	ts, err := st.GetAggTimeSeries("france", Confirmed, TimeSeriesQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := ts.DataPoints[0].Amount, int64(3); got != want {
+		t.Errorf("France's confirmed cases on 2020-01-22 = %d; want %d", got, want)
+	}
+}
+
+func TestSqliteConfirmedAndDeathsJoinedByLocation(t *testing.T) {
+	st := newTestStore(t)
+
+	// The deaths list the provinces in another order, Spain only has confirmed cases and Germany
+	// only has deaths.
+	src := MemSource{
+		ConfirmedGlobalSeries: []byte("Province/State,Country/Region,Lat,Long,1/22/20,1/23/20\n" +
+			"Ontario,Canada,51.25,-85.32,10,20\n" +
+			"Quebec,Canada,52.94,-73.55,30,40\n" +
+			",Spain,40.46,-3.75,5,6\n"),
+		DeathsGlobalSeries: []byte("Province/State,Country/Region,Lat,Long,1/22/20,1/23/20\n" +
+			",Germany,51.17,10.45,1,2\n" +
+			"Quebec,Canada,52.94,-73.55,3,4\n" +
+			"Ontario,Canada,51.25,-85.32,1,2\n"),
+	}
+
+	collector, err := NewJhuCsseDataCollector(st, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := collector.UpdateConfirmedAndDeaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantUnmatched := []UnmatchedLocation{
+		{Country: "Spain", Series: ConfirmedGlobalSeries, Reason: "missing from " + DeathsGlobalSeries},
+		{Country: "Germany", Series: DeathsGlobalSeries, Reason: "missing from " + ConfirmedGlobalSeries},
+	}
+	if !reflect.DeepEqual(report.Unmatched, wantUnmatched) {
+		t.Errorf("Unmatched = %+v; want %+v", report.Unmatched, wantUnmatched)
+	}
+
+	db, err := st.GetDbInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(`select country_slug, province, confirmed_cases, deaths from confirmed_and_deaths_time_series
+	where date_recorded = ? order by country_slug, province`, time.Date(2020, 1, 23, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var countrySlug, province string
+		var confirmed, deaths int
+		if err := rows.Scan(&countrySlug, &province, &confirmed, &deaths); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%s/%s: %d confirmed, %d deaths", countrySlug, province, confirmed, deaths))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"canada/Ontario: 20 confirmed, 2 deaths",
+		"canada/Quebec: 40 confirmed, 4 deaths",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows of 2020-01-23 = %v; want %v", got, want)
+	}
+}
+
+func TestSqliteDailyCountrySummary(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	src := testSource()
+	src[ConfirmedGlobalSeries] = []byte(strings.Replace(testConfirmed, ",Italy,41.87,12.57,0,1,5", ",Italy,41.87,12.57,0,2,5", 1))
+
+	collector, err := NewJhuCsseDataCollector(st, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := collector.UpdateConfirmedAndDeaths(); err != nil {
+		t.Fatal(err)
+	}
+
+	ts, err := st.GetAggTimeSeries("italy", Confirmed, TimeSeriesQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var amounts, news []int64
+	for _, point := range ts.DataPoints {
+		amounts = append(amounts, point.Amount)
+		news = append(news, point.New)
+	}
+
+	if want := []int64{0, 2, 5}; !reflect.DeepEqual(amounts, want) {
+		t.Errorf("Italy's confirmed cases = %v; want %v", amounts, want)
+	}
+	if want := []int64{0, 2, 3}; !reflect.DeepEqual(news, want) {
+		t.Errorf("Italy's new confirmed cases = %v; want %v", news, want)
+	}
+
+	// The update of the confirmed cases keeps the recoveries of the summary.
+	summary, err := st.GetSummary(SummaryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := summary.Recoveries, int64(5); got != want {
+		t.Errorf("Recoveries = %d; want %d", got, want)
+	}
+
+	db, err := st.GetDbInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := dumpTable(t, db, "daily_country_summary")
+
+	// The migration computes the same summary from the time series already stored.
+	if _, err := MigrateDown(st, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MigrateUp(st); err != nil {
+		t.Fatal(err)
+	}
+
+	if after := dumpTable(t, db, "daily_country_summary"); !reflect.DeepEqual(after, before) {
+		t.Errorf("migrated summary = %v; want %v", after, before)
+	}
+}
+
+// dumpTable returns every row of table formatted as a string, sorted.
+func dumpTable(t *testing.T, db *sql.DB, table string) []string {
+	t.Helper()
+
+	rows, err := db.Query("select * from " + table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dump := []string{}
+
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			t.Fatal(err)
+		}
+
+		dump = append(dump, fmt.Sprint(values))
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(dump)
+	return dump
+}
+
+func TestSqliteUSCounties(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	src := MemSource{
+		ConfirmedUSSeries: []byte("UID,iso2,iso3,code3,FIPS,Admin2,Province_State,Country_Region,Lat,Long_,Combined_Key,1/22/20,1/23/20,1/24/20\n" +
+			"84036061,US,USA,840,36061.0,New York,New York,US,40.77,-73.97,\"New York City, New York, US\",1,5,9\n" +
+			"84036119,US,USA,840,36119.0,Westchester,New York,US,41.16,-73.76,\"Westchester, New York, US\",0,2,3\n" +
+			"60,AS,ASM,16,60.0,,American Samoa,US,-14.27,-170.13,\"American Samoa, US\",0,0,0\n"),
+		DeathsUSSeries: []byte("UID,iso2,iso3,code3,FIPS,Admin2,Province_State,Country_Region,Lat,Long_,Combined_Key,Population,1/22/20,1/23/20,1/24/20\n" +
+			"84036061,US,USA,840,36061.0,New York,New York,US,40.77,-73.97,\"New York City, New York, US\",8336817,0,1,2\n" +
+			"84036119,US,USA,840,36119.0,Westchester,New York,US,41.16,-73.76,\"Westchester, New York, US\",967506,0,0,0\n" +
+			"60,AS,ASM,16,60.0,,American Samoa,US,-14.27,-170.13,\"American Samoa, US\",55641,0,0,0\n"),
+	}
+
+	collector, err := NewJhuCsseDataCollector(st, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := collector.UpdateUSCounties()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := report.RowsInserted, 6; got != want {
+		t.Errorf("RowsInserted = %d; want %d", got, want)
+	}
+	if got, want := len(report.Unmatched), 2; got != want {
+		t.Errorf("len(Unmatched) = %d; want %d for the territory without a county", got, want)
+	}
+
+	counties, err := st.GetCounties("us", "new-york")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(counties), 2; got != want {
+		t.Fatalf("len(GetCounties()) = %d; want %d", got, want)
+	}
+
+	if got := counties[1]; got.Slug != "westchester" || got.FIPS != "36119" || got.Population == nil || *got.Population != 967506 {
+		t.Errorf("second county = %+v; want Westchester with its FIPS code and population", got)
+	}
+
+	if _, err := st.GetCounties("us", "atlantis"); !errors.Is(err, ErrUnknownProvince) {
+		t.Errorf("GetCounties() error = %v; want ErrUnknownProvince", err)
+	}
+
+	timeSeries, err := st.GetCountyTimeSeries("usa", "new-york", "new-york", Deaths, TimeSeriesQuery{Order: Descending, PerCapita: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(timeSeries.DataPoints), 3; got != want {
+		t.Fatalf("len(DataPoints) = %d; want %d", got, want)
+	}
+
+	if got := timeSeries.DataPoints[0]; got.County != "New York" || got.FIPS != "36061" || got.Amount != 2 || got.Population == nil {
+		t.Errorf("first data point = %+v; want New York with 2 deaths and its population", got)
+	}
+
+	if _, err := st.GetCountyTimeSeries("us", "new-york", "kings", Confirmed, TimeSeriesQuery{}); !errors.Is(err, ErrUnknownCounty) {
+		t.Errorf("GetCountyTimeSeries() error = %v; want ErrUnknownCounty", err)
+	}
+
+	// Counties are left out of the country level data.
+	summary, err := st.GetSummary(SummaryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := summary.Confirmed, int64(22); got != want {
+		t.Errorf("GetSummary() confirmed = %d; want %d", got, want)
+	}
+
+	timeSeries, err = st.GetTimeSeries("us", Confirmed, TimeSeriesQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(timeSeries.DataPoints); got != 0 {
+		t.Errorf("len(DataPoints) of the US = %d; want 0", got)
+	}
+}
+
+func TestSqliteDailyReports(t *testing.T) {
+	st := newTestStore(t)
+
+	header := "Province_State,Country_Region,Last_Update,Confirmed,Deaths,Recovered,Active,Incident_Rate,Case_Fatality_Ratio\n"
+
+	src := testSource()
+	src[DailyReport(time.Date(2020, 1, 22, 0, 0, 0, 0, time.UTC))] = []byte(header +
+		",France,2020-01-22 23:00:00,2,0,0,2,0.003,0\n")
+	src[DailyReport(time.Date(2020, 1, 23, 0, 0, 0, 0, time.UTC))] = []byte(header +
+		",France,2020-01-23 23:00:00,4,1,0,3,0.006,25\n")
+	src[DailyReport(time.Date(2020, 1, 24, 0, 0, 0, 0, time.UTC))] = []byte(header +
+		"Ontario,Canada,2020-01-24 22:00:00,6,0,0,6,0.04,0\n" +
+		"Quebec,Canada,2020-01-24 23:00:00,2,1,0,1,0.02,50\n" +
+		",France,2020-01-24 21:00:00,9,1,3,5,0.0135,11.1\n" +
+		",France,2020-01-24 21:00:00,9,1,3,5,0.0135,11.1\n")
+	ingest(t, st, src)
+
+	collector, err := NewJhuCsseDataCollector(st, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := collector.UpdateDailyReports()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := report.RowsInserted, 4; got != want {
+		t.Errorf("RowsInserted = %d; want %d", got, want)
+	}
+	if got, want := len(report.Unmatched), 1; got != want {
+		t.Errorf("len(Unmatched) = %d; want %d for the duplicated France", got, want)
+	}
+
+	summary, err := st.GetSummary(SummaryQuery{Sort: "active"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canada := summary.LocationStatsList[0]
+	if canada.Slug != "canada" || canada.Active == nil || *canada.Active != 7 {
+		t.Fatalf("first country = %+v; want Canada with 7 active cases", canada)
+	}
+
+	// 6 cases for 15,000,000 people and 2 cases for 10,000,000 people.
+	if canada.IncidenceRate == nil || *canada.IncidenceRate < 0.0319 || *canada.IncidenceRate > 0.0321 {
+		t.Errorf("Canada's IncidenceRate = %v; want 0.032", canada.IncidenceRate)
+	}
+
+	if lastUpdate := time.Date(2020, 1, 24, 23, 0, 0, 0, time.UTC); canada.LastUpdate == nil || !canada.LastUpdate.Equal(lastUpdate) {
+		t.Errorf("Canada's LastUpdate = %v; want %v", canada.LastUpdate, lastUpdate)
+	}
+
+	if summary.Active == nil || *summary.Active != 7 {
+		t.Errorf("global Active = %v; want 7", summary.Active)
+	}
+
+	// The latest report is read again on the next update.
+	report, err = collector.UpdateDailyReports()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.RowsInserted != 0 || report.RowsUpdated != 2 {
+		t.Errorf("second update inserted %d and updated %d rows; want 0 and 2", report.RowsInserted, report.RowsUpdated)
+	}
+}
+
+func TestSqliteDailyReportsWithMissingDay(t *testing.T) {
+	st := newTestStore(t)
+
+	header := "Province_State,Country_Region,Last_Update,Confirmed,Deaths,Recovered,Active,Incident_Rate,Case_Fatality_Ratio\n"
+
+	// The report of 1/23/20 is missing.
+	src := testSource()
+	src[DailyReport(time.Date(2020, 1, 22, 0, 0, 0, 0, time.UTC))] = []byte(header +
+		",France,2020-01-22 23:00:00,2,0,0,2,0.003,0\n")
+	src[DailyReport(time.Date(2020, 1, 24, 0, 0, 0, 0, time.UTC))] = []byte(header +
+		",France,2020-01-24 21:00:00,9,1,3,5,0.0135,11.1\n")
+	ingest(t, st, src)
+
+	collector, err := NewJhuCsseDataCollector(st, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := collector.UpdateDailyReports()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := report.RowsInserted, 2; got != want {
+		t.Errorf("RowsInserted = %d; want %d", got, want)
+	}
+	if report.LastDate == nil || !report.LastDate.Equal(time.Date(2020, 1, 24, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("LastDate = %v; want 2020-01-24", report.LastDate)
+	}
+
+	summary, err := st.GetSummary(SummaryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Active == nil || *summary.Active != 5 {
+		t.Errorf("global Active = %v; want 5 from the report of 2020-01-24", summary.Active)
+	}
+}
+
+func TestSqliteSubscriptions(t *testing.T) {
+	st := newTestStore(t)
+	ingest(t, st, testSource())
+
+	if err := st.CreateSubscription(&Subscription{CountrySlug: "atlantis"}); !errors.Is(err, ErrUnknownCountry) {
+		t.Errorf("CreateSubscription() of an unknown country returned %v; want ErrUnknownCountry", err)
+	}
+
+	// ISO codes resolve to the country.
+	sub := &Subscription{URL: "https://example.com/hook", Secret: "s3cret", CountrySlug: "ITA", Metric: Confirmed, Rule: AboveRule, Threshold: 3}
+	if err := st.CreateSubscription(sub); err != nil {
+		t.Fatal(err)
+	}
+
+	if sub.ID == 0 || sub.CountrySlug != "italy" {
+		t.Errorf("created subscription = %+v; want an id and the country slug italy", sub)
+	}
+
+	sub.Rule = GrowthRule
+	if err := st.UpdateSubscription(sub); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := st.GetSubscription(sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Rule != GrowthRule || stored.Secret != "s3cret" || !stored.CreatedAt.Equal(sub.CreatedAt) {
+		t.Errorf("GetSubscription() = %+v; want %+v", stored, sub)
+	}
+
+	date := time.Date(2020, 1, 24, 0, 0, 0, 0, time.UTC)
+	statusCode := 200
+
+	for _, d := range []*Delivery{
+		{SubscriptionID: sub.ID, Date: date, Attempt: 1, Error: "connection refused", Payload: []byte(`{"value":5}`), AttemptedAt: time.Now().UTC()},
+		{SubscriptionID: sub.ID, Date: date, Attempt: 2, StatusCode: &statusCode, Payload: []byte(`{"value":5}`), AttemptedAt: time.Now().UTC()},
+	} {
+		if err := st.RecordDelivery(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deliveries, err := st.GetDeliveries(sub.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(deliveries), 2; got != want {
+		t.Fatalf("len(GetDeliveries()) = %d; want %d", got, want)
+	}
+
+	if latest := deliveries[0]; latest.Attempt != 2 || !latest.Succeeded() || !latest.Date.Equal(date) || string(latest.Payload) != `{"value":5}` {
+		t.Errorf("latest delivery = %+v; want the successful second attempt", latest)
+	}
+	if first := deliveries[1]; first.Succeeded() || first.Error != "connection refused" {
+		t.Errorf("first delivery = %+v; want the failed first attempt", first)
+	}
+
+	if err := st.DeleteSubscription(sub.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.GetDeliveries(sub.ID, 10); !errors.Is(err, ErrUnknownSubscription) {
+		t.Errorf("GetDeliveries() of a deleted subscription returned %v; want ErrUnknownSubscription", err)
+	}
+	if err := st.DeleteSubscription(sub.ID); !errors.Is(err, ErrUnknownSubscription) {
+		t.Errorf("DeleteSubscription() of a deleted subscription returned %v; want ErrUnknownSubscription", err)
+	}
+}
@@ -2,6 +2,11 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -11,16 +16,89 @@ const (
 	Deaths            = "deaths"
 )
 
+// Country identifies a country. Its ISO 3166 codes, continent and WHO region are only filled in by
+// GetCountries and GetSummary, and are empty for countries missing from the bundled reference data.
 type Country struct {
-	Name string `json:"countryName"`
-	Slug string `json:"countrySlug"`
+	Name      string `json:"countryName"`
+	Slug      string `json:"countrySlug"`
+	ISO2      string `json:"iso2,omitempty"`
+	ISO3      string `json:"iso3,omitempty"`
+	Continent string `json:"continent,omitempty"`
+	WHORegion string `json:"whoRegion,omitempty"`
+}
+
+// Province is a province or state that a country is reported by.
+type Province struct {
+	Country
+	Name string `json:"provinceName"`
+	Slug string `json:"provinceSlug"`
+}
+
+// County is a county of a province, as reported for the US. FIPS is its US county code and Population
+// is nil when the source does not report it.
+type County struct {
+	Province
+	Name       string `json:"countyName"`
+	Slug       string `json:"countySlug"`
+	FIPS       string `json:"fips,omitempty"`
+	Population *int64 `json:"population,omitempty"`
+}
+
+// Region groups countries by continent or by WHO region.
+type Region struct {
+	Name string `json:"regionName"`
+	Slug string `json:"regionSlug"`
+	Kind string `json:"kind"`
+}
+
+// Kinds of Region.
+const (
+	ContinentRegion = "continent"
+	WHORegion       = "whoRegion"
+)
+
+// Regions accepted by SummaryQuery.Region and GetRegionTimeSeries. The slug of a WHO region is its lowercased code.
+var Regions = []Region{
+	{"Africa", "africa", ContinentRegion},
+	{"Asia", "asia", ContinentRegion},
+	{"Europe", "europe", ContinentRegion},
+	{"North America", "north-america", ContinentRegion},
+	{"South America", "south-america", ContinentRegion},
+	{"Oceania", "oceania", ContinentRegion},
+	{"African Region", "afro", WHORegion},
+	{"Region of the Americas", "amro", WHORegion},
+	{"South-East Asia Region", "searo", WHORegion},
+	{"European Region", "euro", WHORegion},
+	{"Eastern Mediterranean Region", "emro", WHORegion},
+	{"Western Pacific Region", "wpro", WHORegion},
+}
+
+func findRegion(slug string) (*Region, error) {
+	for i := range Regions {
+		if Regions[i].Slug == strings.ToLower(slug) {
+			return &Regions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownRegion, slug)
+}
+
+// filter returns the column of the countries table and the value its member countries have.
+func (r Region) filter() (string, string) {
+	if r.Kind == WHORegion {
+		return "who_region", strings.ToUpper(r.Slug)
+	}
+	return "continent", r.Name
 }
 
 type Location struct {
 	Country
-	Province  string  `json:"province"`
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
+	Province     string  `json:"province"`
+	ProvinceSlug string  `json:"provinceSlug,omitempty"`
+	County       string  `json:"county,omitempty"`
+	CountySlug   string  `json:"countySlug,omitempty"`
+	FIPS         string  `json:"fips,omitempty"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
 }
 
 type CovidStats struct {
@@ -32,13 +110,46 @@ type CovidStats struct {
 	NewDeaths     int64 `json:"newDeaths"`
 }
 
+// PerCapitaStats relates CovidStats to the population of a location.
+// Its fields are nil when the population is unknown.
+type PerCapitaStats struct {
+	Population          *int64   `json:"population,omitempty"`
+	ConfirmedPer100k    *float64 `json:"confirmedPer100k,omitempty"`
+	NewConfirmedPer100k *float64 `json:"newConfirmedPer100k,omitempty"`
+	DeathsPer100k       *float64 `json:"deathsPer100k,omitempty"`
+}
+
+// DailyReportStats are the values that JHU CSSE only publishes in its daily reports. Its fields are nil
+// when no daily report was ingested for the date. IncidenceRate is the number of confirmed cases per
+// 100,000 people as estimated by JHU CSSE.
+type DailyReportStats struct {
+	Active        *int64     `json:"active,omitempty"`
+	IncidenceRate *float64   `json:"incidenceRate,omitempty"`
+	LastUpdate    *time.Time `json:"lastUpdate,omitempty"`
+}
+
 type LocationStats struct {
 	Location
 	CovidStats
+	PerCapitaStats
+	DailyReportStats
+}
+
+// GlobalStats are the worldwide totals as of the latest complete date of each table:
+// AsOf for confirmed cases and deaths, RecoveriesAsOf for recoveries.
+type GlobalStats struct {
+	CovidStats
+	AsOf           time.Time `json:"asOf"`
+	RecoveriesAsOf time.Time `json:"recoveriesAsOf"`
 }
 
 type Summary struct {
 	CovidStats
+	PerCapitaStats
+	DailyReportStats
+	Region            *Region         `json:"region,omitempty"`
+	AsOf              time.Time       `json:"asOf"`
+	RecoveriesAsOf    time.Time       `json:"recoveriesAsOf"`
 	LocationStatsList []LocationStats `json:"countries"`
 }
 
@@ -48,18 +159,328 @@ type TimeSeriesDataPoint struct {
 	New    int64     `json:"new"`
 	Status string    `json:"status"`
 	Date   time.Time `json:"date"`
+
+	// Set when TimeSeriesQuery.PerCapita is and the population of the location is known.
+	Population    *int64   `json:"population,omitempty"`
+	AmountPer100k *float64 `json:"amountPer100k,omitempty"`
+	NewPer100k    *float64 `json:"newPer100k,omitempty"`
+
+	// Set by the analytics package when requested.
+	NewAvg            *float64 `json:"newAvg,omitempty"`
+	GrowthRate        *float64 `json:"growthRate,omitempty"`
+	DoublingTime      *float64 `json:"doublingTime,omitempty"`
+	CaseFatalityRatio *float64 `json:"caseFatalityRatio,omitempty"`
 }
 
 type TimeSeries struct {
+	Region     *Region               `json:"region,omitempty"`
 	DataPoints []TimeSeriesDataPoint `json:"timeSeries"`
 }
 
+func newPerCapitaStats(stats CovidStats, population int64) PerCapitaStats {
+	return PerCapitaStats{
+		Population:          &population,
+		ConfirmedPer100k:    per100k(stats.Confirmed, population),
+		NewConfirmedPer100k: per100k(stats.NewConfirmed, population),
+		DeathsPer100k:       per100k(stats.Deaths, population),
+	}
+}
+
+func (dataPoint *TimeSeriesDataPoint) setPopulation(population int64) {
+	dataPoint.Population = &population
+	dataPoint.AmountPer100k = per100k(dataPoint.Amount, population)
+	dataPoint.NewPer100k = per100k(dataPoint.New, population)
+}
+
+func per100k(n int64, population int64) *float64 {
+	if population <= 0 {
+		return nil
+	}
+
+	v := float64(n) * 100000 / float64(population)
+	return &v
+}
+
+// Orders accepted by TimeSeriesQuery.
+const (
+	Ascending  = "asc"
+	Descending = "desc"
+)
+
+// Comparison lines up the aggregated time series of several countries on the same dates.
+type Comparison struct {
+	Status    string             `json:"status"`
+	Dates     []time.Time        `json:"dates"`
+	Countries []ComparisonSeries `json:"countries"`
+}
+
+// ComparisonSeries holds the amounts of one country on each date of a Comparison,
+// or nil on dates the country has no data for.
+type ComparisonSeries struct {
+	Country
+	Amounts []*int64 `json:"amounts"`
+	New     []*int64 `json:"new"`
+}
+
+// TimeSeriesQuery narrows down a time series. The zero value selects every date in ascending order.
+type TimeSeriesQuery struct {
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Order     string
+	PerCapita bool
+}
+
+func (q TimeSeriesQuery) filter(column string) (string, []interface{}) {
+	filter := ""
+	args := []interface{}{}
+
+	if !q.From.IsZero() {
+		filter += fmt.Sprintf(" and %s >= ?", column)
+		args = append(args, q.From)
+	}
+	if !q.To.IsZero() {
+		filter += fmt.Sprintf(" and %s <= ?", column)
+		args = append(args, q.To)
+	}
+
+	return filter, args
+}
+
+func (q TimeSeriesQuery) direction() string {
+	if q.Order == Descending {
+		return "desc"
+	}
+	return "asc"
+}
+
+// Series recorded in IngestRun.
+const (
+	ConfirmedAndDeathsRun = "confirmed_and_deaths"
+	RecoveriesRun         = "recoveries"
+	USCountiesRun         = "us_counties"
+	DailyReportsRun       = "daily_reports"
+)
+
+type IngestRun struct {
+	ID           int64      `json:"id"`
+	Series       string     `json:"series"`
+	Source       string     `json:"source"`
+	StartedAt    time.Time  `json:"startedAt"`
+	FinishedAt   time.Time  `json:"finishedAt"`
+	RowsRead     int        `json:"rowsRead"`
+	RowsInserted int        `json:"rowsInserted"`
+	RowsUpdated  int        `json:"rowsUpdated"`
+	RowsSkipped  int        `json:"rowsSkipped"`
+	FirstDate    *time.Time `json:"firstDate"`
+	LastDate     *time.Time `json:"lastDate"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// Rules of Subscription.
+const (
+	// AboveRule holds when the new cases of the latest date exceed the threshold.
+	AboveRule = "above"
+	// GrowthRule holds when the new cases of the last 7 days exceed those of the 7 days before
+	// by more than the threshold, in percent.
+	GrowthRule = "growth"
+)
+
+// Subscription asks for a webhook to be delivered to URL when Rule holds for the new cases of Metric,
+// one of the statuses, in a country. Deliveries are signed with Secret.
+type Subscription struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	CountrySlug string    `json:"countrySlug"`
+	Metric      string    `json:"metric"`
+	Rule        string    `json:"rule"`
+	Threshold   float64   `json:"threshold"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Delivery is one attempt to deliver the webhook of a Subscription about the data of Date.
+// StatusCode is nil when the target did not respond.
+type Delivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscriptionId"`
+	Date           time.Time       `json:"date"`
+	Attempt        int             `json:"attempt"`
+	StatusCode     *int            `json:"statusCode"`
+	Error          string          `json:"error,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	AttemptedAt    time.Time       `json:"attemptedAt"`
+}
+
+// Succeeded reports whether the target acknowledged the delivery with a 2xx status code.
+func (d Delivery) Succeeded() bool {
+	return d.StatusCode != nil && *d.StatusCode >= 200 && *d.StatusCode < 300
+}
+
+// ErrNoData is returned when there is no data for the requested date.
+var ErrNoData = errors.New("no data for the requested date")
+
+// ErrUnknownProvince is returned for a province slug that the country has no data for.
+var ErrUnknownProvince = errors.New("unknown province")
+
+// ErrUnknownCounty is returned for a county slug that the province has no data for.
+var ErrUnknownCounty = errors.New("unknown county")
+
+// ErrUnknownSubscription is returned for a subscription id that does not exist.
+var ErrUnknownSubscription = errors.New("unknown subscription")
+
+// ErrUnknownRegion is returned for a region slug that is not one of Regions.
+var ErrUnknownRegion = errors.New("unknown region")
+
+// ErrUnknownCountry matches the UnknownCountryError returned for a country slug the store has no data for.
+var ErrUnknownCountry = errors.New("unknown country")
+
+type UnknownCountryError struct {
+	Slug string
+}
+
+func (e *UnknownCountryError) Error() string {
+	return fmt.Sprintf("unknown country %q", e.Slug)
+}
+
+func (e *UnknownCountryError) Is(target error) bool {
+	return target == ErrUnknownCountry
+}
+
+// SummaryQuery narrows down a summary. The zero value summarizes the latest complete date
+// with every country in the order of the store.
+type SummaryQuery struct {
+	Date time.Time
+
+	// Region is the slug of one of Regions to only summarize its member countries.
+	Region string
+	// Provinces splits countries reported by province into one entry per province.
+	Provinces bool
+
+	// Sort is one of Metrics. Countries without a value for it come last.
+	Sort string
+	// Order of Sort, Descending unless set to Ascending.
+	Order  string
+	Limit  int
+	Offset int
+	// MinConfirmed leaves out countries with fewer confirmed cases.
+	MinConfirmed int64
+}
+
+// Metrics of LocationStats that countries can be sorted and ranked by, named after their JSON fields.
+var Metrics = []string{
+	"confirmed", "newConfirmed", "recovered", "newRecovered", "deaths", "newDeaths",
+	"confirmedPer100k", "newConfirmedPer100k", "deathsPer100k", "active", "incidenceRate",
+}
+
+func IsMetric(name string) bool {
+	for _, metric := range Metrics {
+		if metric == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Metric returns the value of the named metric, or nil if it is unknown, such as a per-capita
+// metric of a country without a population or a daily report metric of a date without a report.
+func (ls LocationStats) Metric(name string) *float64 {
+	var v float64
+
+	switch name {
+	case "confirmed":
+		v = float64(ls.Confirmed)
+	case "newConfirmed":
+		v = float64(ls.NewConfirmed)
+	case "recovered":
+		v = float64(ls.Recoveries)
+	case "newRecovered":
+		v = float64(ls.NewRecoveries)
+	case "deaths":
+		v = float64(ls.Deaths)
+	case "newDeaths":
+		v = float64(ls.NewDeaths)
+	case "confirmedPer100k":
+		return ls.ConfirmedPer100k
+	case "newConfirmedPer100k":
+		return ls.NewConfirmedPer100k
+	case "deathsPer100k":
+		return ls.DeathsPer100k
+	case "active":
+		if ls.Active == nil {
+			return nil
+		}
+		v = float64(*ls.Active)
+	case "incidenceRate":
+		return ls.IncidenceRate
+	default:
+		return nil
+	}
+
+	return &v
+}
+
+// apply filters, sorts and pages list as requested by q.
+func (q SummaryQuery) apply(list []LocationStats) []LocationStats {
+	filtered := []LocationStats{}
+	for _, locationStats := range list {
+		if locationStats.Confirmed >= q.MinConfirmed {
+			filtered = append(filtered, locationStats)
+		}
+	}
+
+	if q.Sort != "" {
+		sort.SliceStable(filtered, func(i, j int) bool {
+			a, b := filtered[i].Metric(q.Sort), filtered[j].Metric(q.Sort)
+			if a == nil || b == nil {
+				return a != nil
+			}
+			if q.Order == Ascending {
+				return *a < *b
+			}
+			return *a > *b
+		})
+	}
+
+	if q.Offset >= len(filtered) {
+		return []LocationStats{}
+	}
+	filtered = filtered[q.Offset:]
+
+	if q.Limit > 0 && q.Limit < len(filtered) {
+		filtered = filtered[:q.Limit]
+	}
+
+	return filtered
+}
+
 type Service interface {
 	GetCountries() ([]Country, error)
-	GetGlobalStats() (*CovidStats, error)
-	GetSummary() (*Summary, error)
-	GetTimeSeries(countrySlug string, status string) (*TimeSeries, error)
-	GetAggTimeSeries(countrySlug string, status string) (*TimeSeries, error)
+	GetGlobalStats(date time.Time) (*GlobalStats, error)
+	GetSummary(q SummaryQuery) (*Summary, error)
+	GetProvinces(countrySlug string) ([]Province, error)
+	GetTimeSeries(countrySlug string, status string, q TimeSeriesQuery) (*TimeSeries, error)
+	GetProvinceTimeSeries(countrySlug string, provinceSlug string, status string, q TimeSeriesQuery) (*TimeSeries, error)
+	GetCounties(countrySlug string, provinceSlug string) ([]County, error)
+	GetCountyTimeSeries(countrySlug string, provinceSlug string, countySlug string, status string, q TimeSeriesQuery) (*TimeSeries, error)
+	GetAggTimeSeries(countrySlug string, status string, q TimeSeriesQuery) (*TimeSeries, error)
+	GetComparison(countrySlugs []string, status string, q TimeSeriesQuery) (*Comparison, error)
+	GetRegionTimeSeries(region string, status string, q TimeSeriesQuery) (*TimeSeries, error)
+	GetIngestRuns(limit int) ([]IngestRun, error)
+	// GetLastIngest returns when the latest successful ingest run finished, or the zero time if none did.
+	GetLastIngest() (time.Time, error)
+	// CreateSubscription stores sub under the canonical slug of its country and sets its ID and CreatedAt.
+	CreateSubscription(sub *Subscription) error
+	GetSubscriptions() ([]Subscription, error)
+	GetSubscription(id int64) (*Subscription, error)
+	// UpdateSubscription replaces the stored subscription with the ID of sub, except for its CreatedAt.
+	UpdateSubscription(sub *Subscription) error
+	// DeleteSubscription deletes a subscription along with its deliveries.
+	DeleteSubscription(id int64) error
+	// RecordDelivery stores d and sets its ID.
+	RecordDelivery(d *Delivery) error
+	// GetDeliveries returns the latest deliveries of a subscription, newest first.
+	GetDeliveries(subscriptionID int64, limit int) ([]Delivery, error)
 	GetDbInstance() (*sql.DB, error)
 	Close() error
 }
@@ -2,38 +2,270 @@ package storetest
 
 import (
 	"database/sql"
+	"sync"
+	"time"
 
 	"github.com/jaaanko/covid-19-api/internal/store"
 )
 
 type StubStore struct {
-	Countries     []store.Country
-	GlobalStats   store.CovidStats
+	// When set, time series of other countries return an UnknownCountryError.
+	Countries []store.Country
+	// Provinces are returned for any known country. When set, province time series of other provinces
+	// return ErrUnknownProvince.
+	Provinces []store.Province
+	// Counties are returned for any known country, filtered by province. When set, county time series
+	// of other counties return ErrUnknownCounty.
+	Counties      []store.County
+	GlobalStats   store.GlobalStats
 	Summary       store.Summary
 	TimeSeries    store.TimeSeries
 	AggTimeSeries store.TimeSeries
+	// ProvinceTimeSeries is returned for any known province.
+	ProvinceTimeSeries store.TimeSeries
+	// CountyTimeSeries is returned for any known county.
+	CountyTimeSeries store.TimeSeries
+	// RegionTimeSeries is returned for any region, and Summary for any SummaryQuery.Region.
+	RegionTimeSeries store.TimeSeries
+	IngestRuns       []store.IngestRun
+	LastIngest       time.Time
+	Comparison       store.Comparison
+
+	// Subscriptions and Deliveries are kept in memory, and can be used from several goroutines.
+	Subscriptions []store.Subscription
+	Deliveries    []store.Delivery
+	mu            sync.Mutex
+
+	// TimeSeriesQuery is the query received by the last GetTimeSeries, GetProvinceTimeSeries,
+	// GetCountyTimeSeries, GetAggTimeSeries or GetComparison call.
+	TimeSeriesQuery store.TimeSeriesQuery
+
+	// SummaryQuery is the query received by the last GetSummary call.
+	SummaryQuery store.SummaryQuery
+
+	// ComparedCountries are the countries received by the last GetComparison call.
+	ComparedCountries []string
 }
 
 func (s *StubStore) GetCountries() ([]store.Country, error) {
 	return s.Countries, nil
 }
 
-func (s *StubStore) GetGlobalStats() (*store.CovidStats, error) {
+func (s *StubStore) GetGlobalStats(date time.Time) (*store.GlobalStats, error) {
+	if !date.IsZero() && !date.Equal(s.GlobalStats.AsOf) {
+		return nil, store.ErrNoData
+	}
 	return &s.GlobalStats, nil
 }
 
-func (s *StubStore) GetSummary() (*store.Summary, error) {
+func (s *StubStore) GetSummary(q store.SummaryQuery) (*store.Summary, error) {
+	s.SummaryQuery = q
+	if !q.Date.IsZero() && !q.Date.Equal(s.Summary.AsOf) {
+		return nil, store.ErrNoData
+	}
 	return &s.Summary, nil
 }
 
-func (s *StubStore) GetTimeSeries(countrySlug string, status string) (*store.TimeSeries, error) {
+func (s *StubStore) GetTimeSeries(countrySlug string, status string, q store.TimeSeriesQuery) (*store.TimeSeries, error) {
+	s.TimeSeriesQuery = q
+	if err := s.checkCountry(countrySlug); err != nil {
+		return nil, err
+	}
 	return &s.TimeSeries, nil
 }
 
-func (s *StubStore) GetAggTimeSeries(countrySlug string, status string) (*store.TimeSeries, error) {
+func (s *StubStore) GetProvinces(countrySlug string) ([]store.Province, error) {
+	if err := s.checkCountry(countrySlug); err != nil {
+		return nil, err
+	}
+	return s.Provinces, nil
+}
+
+func (s *StubStore) GetProvinceTimeSeries(countrySlug string, provinceSlug string, status string, q store.TimeSeriesQuery) (*store.TimeSeries, error) {
+	s.TimeSeriesQuery = q
+	if err := s.checkCountry(countrySlug); err != nil {
+		return nil, err
+	}
+
+	if s.Provinces != nil {
+		known := false
+		for _, province := range s.Provinces {
+			known = known || province.Slug == provinceSlug
+		}
+		if !known {
+			return nil, store.ErrUnknownProvince
+		}
+	}
+	return &s.ProvinceTimeSeries, nil
+}
+
+func (s *StubStore) GetCounties(countrySlug string, provinceSlug string) ([]store.County, error) {
+	if err := s.checkCountry(countrySlug); err != nil {
+		return nil, err
+	}
+
+	if provinceSlug == "" {
+		return s.Counties, nil
+	}
+
+	counties := []store.County{}
+	for _, county := range s.Counties {
+		if county.Province.Slug == provinceSlug {
+			counties = append(counties, county)
+		}
+	}
+
+	if len(counties) == 0 {
+		return nil, store.ErrUnknownProvince
+	}
+	return counties, nil
+}
+
+func (s *StubStore) GetCountyTimeSeries(countrySlug string, provinceSlug string, countySlug string, status string, q store.TimeSeriesQuery) (*store.TimeSeries, error) {
+	s.TimeSeriesQuery = q
+	if err := s.checkCountry(countrySlug); err != nil {
+		return nil, err
+	}
+
+	if s.Counties != nil {
+		known := false
+		for _, county := range s.Counties {
+			known = known || county.Province.Slug == provinceSlug && county.Slug == countySlug
+		}
+		if !known {
+			return nil, store.ErrUnknownCounty
+		}
+	}
+	return &s.CountyTimeSeries, nil
+}
+
+func (s *StubStore) GetAggTimeSeries(countrySlug string, status string, q store.TimeSeriesQuery) (*store.TimeSeries, error) {
+	s.TimeSeriesQuery = q
+	if err := s.checkCountry(countrySlug); err != nil {
+		return nil, err
+	}
 	return &s.AggTimeSeries, nil
 }
 
+func (s *StubStore) GetComparison(countrySlugs []string, status string, q store.TimeSeriesQuery) (*store.Comparison, error) {
+	s.ComparedCountries = countrySlugs
+	s.TimeSeriesQuery = q
+	return &s.Comparison, nil
+}
+
+func (s *StubStore) GetRegionTimeSeries(region string, status string, q store.TimeSeriesQuery) (*store.TimeSeries, error) {
+	s.TimeSeriesQuery = q
+	return &s.RegionTimeSeries, nil
+}
+
+func (s *StubStore) GetIngestRuns(limit int) ([]store.IngestRun, error) {
+	if limit < len(s.IngestRuns) {
+		return s.IngestRuns[:limit], nil
+	}
+	return s.IngestRuns, nil
+}
+
+func (s *StubStore) GetLastIngest() (time.Time, error) {
+	return s.LastIngest, nil
+}
+
+func (s *StubStore) CreateSubscription(sub *store.Subscription) error {
+	if err := s.checkCountry(sub.CountrySlug); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub.ID = int64(len(s.Subscriptions)) + 1
+	for _, stored := range s.Subscriptions {
+		if stored.ID >= sub.ID {
+			sub.ID = stored.ID + 1
+		}
+	}
+	sub.CreatedAt = time.Now().UTC()
+
+	s.Subscriptions = append(s.Subscriptions, *sub)
+	return nil
+}
+
+func (s *StubStore) GetSubscriptions() ([]store.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]store.Subscription{}, s.Subscriptions...), nil
+}
+
+func (s *StubStore) GetSubscription(id int64) (*store.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sub := range s.Subscriptions {
+		if sub.ID == id {
+			return &sub, nil
+		}
+	}
+	return nil, store.ErrUnknownSubscription
+}
+
+func (s *StubStore) UpdateSubscription(sub *store.Subscription) error {
+	if err := s.checkCountry(sub.CountrySlug); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, stored := range s.Subscriptions {
+		if stored.ID == sub.ID {
+			sub.CreatedAt = stored.CreatedAt
+			s.Subscriptions[i] = *sub
+			return nil
+		}
+	}
+	return store.ErrUnknownSubscription
+}
+
+func (s *StubStore) DeleteSubscription(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, sub := range s.Subscriptions {
+		if sub.ID == id {
+			s.Subscriptions = append(s.Subscriptions[:i], s.Subscriptions[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrUnknownSubscription
+}
+
+func (s *StubStore) RecordDelivery(d *store.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d.ID = int64(len(s.Deliveries)) + 1
+	s.Deliveries = append(s.Deliveries, *d)
+	return nil
+}
+
+// GetDeliveries returns the deliveries of a subscription in the reverse order they were recorded.
+func (s *StubStore) GetDeliveries(subscriptionID int64, limit int) ([]store.Delivery, error) {
+	if _, err := s.GetSubscription(subscriptionID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := []store.Delivery{}
+	for i := len(s.Deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if s.Deliveries[i].SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, s.Deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
 func (s *StubStore) GetDbInstance() (*sql.DB, error) {
 	return nil, nil
 }
@@ -41,3 +273,16 @@ func (s *StubStore) GetDbInstance() (*sql.DB, error) {
 func (s *StubStore) Close() error {
 	return nil
 }
+
+func (s *StubStore) checkCountry(countrySlug string) error {
+	if s.Countries == nil {
+		return nil
+	}
+
+	for _, country := range s.Countries {
+		if country.Slug == countrySlug {
+			return nil
+		}
+	}
+	return &store.UnknownCountryError{Slug: countrySlug}
+}
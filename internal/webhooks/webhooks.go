@@ -0,0 +1,362 @@
+// Package webhooks evaluates the subscriptions of the store after each update of the time series,
+// and delivers a signed webhook to the subscriptions whose rule holds.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jaaanko/covid-19-api/internal/events"
+	"github.com/jaaanko/covid-19-api/internal/store"
+)
+
+// SignatureHeader holds the hex-encoded HMAC-SHA256 of the body of a delivery, keyed with the
+// secret of the subscription and prefixed with "sha256=".
+const SignatureHeader = "X-Covid19-Signature"
+
+// ErrPrivateTarget is returned for a webhook URL whose host is a loopback, private, link-local or
+// unspecified address, which the API must not be used to reach.
+var ErrPrivateTarget = errors.New("webhook target is not a public address")
+
+// growthWindow is the number of days compared by store.GrowthRule.
+const growthWindow = 7
+
+// seriesMetrics are the metrics changed by the update of each series.
+var seriesMetrics = map[string][]string{
+	store.ConfirmedAndDeathsRun: {store.Confirmed, store.Deaths},
+	store.RecoveriesRun:         {store.Recoveries},
+}
+
+// Alert is the body of a delivery. Value is the new cases of the date for store.AboveRule, and their
+// growth over the last 7 days in percent for store.GrowthRule.
+type Alert struct {
+	SubscriptionID int64     `json:"subscriptionId"`
+	CountrySlug    string    `json:"countrySlug"`
+	Metric         string    `json:"metric"`
+	Rule           string    `json:"rule"`
+	Threshold      float64   `json:"threshold"`
+	Value          float64   `json:"value"`
+	Date           time.Time `json:"date"`
+}
+
+type Notifier struct {
+	store  store.Service
+	client *http.Client
+
+	// Attempts is the number of times a delivery is tried before giving up.
+	Attempts int
+	// Backoff is the delay before the first retry, doubled before each next one.
+	Backoff time.Duration
+	// AllowPrivateTargets lets deliveries reach the addresses rejected with ErrPrivateTarget, such
+	// as a receiver on the same host.
+	AllowPrivateTargets bool
+
+	mu sync.Mutex
+	// delivering holds the subscriptions whose alert is being delivered, which are not evaluated
+	// again until the delivery is done.
+	delivering map[int64]bool
+}
+
+func NewNotifier(st store.Service) *Notifier {
+	n := &Notifier{
+		store:    st,
+		Attempts: 5,
+		Backoff:  time.Minute,
+
+		delivering: map[int64]bool{},
+	}
+
+	// The address is checked when it is dialed rather than when the URL is resolved, so that a host
+	// cannot resolve to a public address for the check and to a private one for the request. Proxies
+	// are not used, since they would be dialed instead.
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); (ip == nil || isPrivate(ip)) && !n.AllowPrivateTargets {
+				return ErrPrivateTarget
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	n.client = &http.Client{Transport: transport, Timeout: 10 * time.Second}
+	return n
+}
+
+// CheckTarget returns ErrPrivateTarget if host is, or resolves to, an address that deliveries
+// refuse to reach. A host that cannot be resolved is left for the delivery to reject.
+func CheckTarget(ctx context.Context, host string) error {
+	ips := []net.IP{net.ParseIP(host)}
+
+	if ips[0] == nil {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil
+		}
+
+		ips = ips[:0]
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	for _, ip := range ips {
+		if isPrivate(ip) {
+			return ErrPrivateTarget
+		}
+	}
+	return nil
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// Listen evaluates the subscriptions after every ingest-completed event published on bus. The
+// deliveries are left running, so that their retries do not hold up the next events.
+func (n *Notifier) Listen(bus *events.Bus) {
+	bus.Listen(func(event events.Event) {
+		report, ok := event.Data.(*store.IngestReport)
+		if event.Type != events.IngestCompleted || !ok {
+			return
+		}
+
+		if _, err := n.start(report); err != nil {
+			log.Println("error evaluating subscriptions:", err)
+		}
+	})
+}
+
+// Evaluate checks the subscriptions to the metrics and countries changed by the update of report,
+// and delivers an alert to those whose rule holds. A subscription is alerted once per date. It
+// returns once every delivery succeeded or ran out of attempts.
+func (n *Notifier) Evaluate(report *store.IngestReport) error {
+	wg, err := n.start(report)
+	if err != nil {
+		return err
+	}
+
+	wg.Wait()
+	return nil
+}
+
+// start evaluates the subscriptions changed by the update of report and starts delivering their
+// alerts, which are done once the returned WaitGroup is.
+func (n *Notifier) start(report *store.IngestReport) (*sync.WaitGroup, error) {
+	wg := &sync.WaitGroup{}
+
+	metrics := map[string]bool{}
+	for _, metric := range seriesMetrics[report.Series] {
+		metrics[metric] = true
+	}
+
+	if len(metrics) == 0 {
+		return wg, nil
+	}
+
+	changed := map[string]bool{}
+	for _, countrySlug := range report.Countries {
+		changed[countrySlug] = true
+	}
+
+	subs, err := n.store.GetSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sub := range subs {
+		if !metrics[sub.Metric] || !changed[sub.CountrySlug] || !n.claim(sub.ID) {
+			continue
+		}
+
+		alert, err := n.evaluate(sub)
+		if err != nil {
+			log.Printf("could not evaluate subscription %d: %v\n", sub.ID, err)
+		}
+		if alert == nil {
+			n.release(sub.ID)
+			continue
+		}
+
+		wg.Add(1)
+		go func(sub store.Subscription) {
+			defer wg.Done()
+			defer n.release(sub.ID)
+			n.deliver(sub, alert)
+		}(sub)
+	}
+
+	return wg, nil
+}
+
+// claim reports whether no alert of the subscription id is being delivered, and marks it as
+// delivering if so.
+func (n *Notifier) claim(id int64) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.delivering[id] {
+		return false
+	}
+
+	n.delivering[id] = true
+	return true
+}
+
+func (n *Notifier) release(id int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.delivering, id)
+}
+
+// evaluate returns the alert of sub for the latest date, or nil if its rule does not hold or the
+// alert was already delivered.
+func (n *Notifier) evaluate(sub store.Subscription) (*Alert, error) {
+	ts, err := n.store.GetAggTimeSeries(sub.CountrySlug, sub.Metric, store.TimeSeriesQuery{Order: store.Descending, Limit: 2 * growthWindow})
+	if err != nil {
+		return nil, err
+	}
+
+	points := ts.DataPoints
+	if len(points) == 0 {
+		return nil, nil
+	}
+
+	alert := &Alert{
+		SubscriptionID: sub.ID,
+		CountrySlug:    sub.CountrySlug,
+		Metric:         sub.Metric,
+		Rule:           sub.Rule,
+		Threshold:      sub.Threshold,
+		Date:           points[0].Date,
+	}
+
+	switch sub.Rule {
+	case store.AboveRule:
+		alert.Value = float64(points[0].New)
+	case store.GrowthRule:
+		if len(points) < 2*growthWindow {
+			return nil, nil
+		}
+
+		var current, previous int64
+		for i, point := range points {
+			if i < growthWindow {
+				current += point.New
+			} else {
+				previous += point.New
+			}
+		}
+
+		if previous == 0 {
+			return nil, nil
+		}
+		alert.Value = float64(current-previous) / float64(previous) * 100
+	default:
+		return nil, fmt.Errorf("unknown rule %q", sub.Rule)
+	}
+
+	if alert.Value <= sub.Threshold {
+		return nil, nil
+	}
+
+	latest, err := n.store.GetDeliveries(sub.ID, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(latest) > 0 && latest[0].Succeeded() && latest[0].Date.Equal(alert.Date) {
+		return nil, nil
+	}
+
+	return alert, nil
+}
+
+// deliver posts alert to the URL of sub until it succeeds or runs out of attempts, recording every attempt.
+func (n *Notifier) deliver(sub store.Subscription, alert *Alert) {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		log.Printf("could not encode alert of subscription %d: %v\n", sub.ID, err)
+		return
+	}
+
+	backoff := n.Backoff
+
+	for attempt := 1; attempt <= n.Attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		d := &store.Delivery{
+			SubscriptionID: sub.ID,
+			Date:           alert.Date,
+			Attempt:        attempt,
+			Payload:        payload,
+			AttemptedAt:    time.Now().UTC(),
+		}
+
+		if statusCode, err := n.post(sub, payload); err != nil {
+			d.Error = err.Error()
+		} else {
+			d.StatusCode = &statusCode
+		}
+
+		if err := n.store.RecordDelivery(d); err != nil {
+			log.Printf("could not record delivery of subscription %d: %v\n", sub.ID, err)
+		}
+
+		if d.Succeeded() {
+			return
+		}
+	}
+
+	log.Printf("gave up delivering to subscription %d after %d attempts\n", sub.ID, n.Attempts)
+}
+
+func (n *Notifier) post(sub store.Subscription, payload []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, payload))
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	return res.StatusCode, nil
+}
+
+// Sign returns the value of SignatureHeader for payload, which receivers compare to their own
+// computation with hmac.Equal.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
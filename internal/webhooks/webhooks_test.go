@@ -0,0 +1,273 @@
+package webhooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jaaanko/covid-19-api/internal/events"
+	"github.com/jaaanko/covid-19-api/internal/store"
+	"github.com/jaaanko/covid-19-api/internal/store/storetest"
+	"github.com/jaaanko/covid-19-api/internal/webhooks"
+)
+
+// newTimeSeries returns the data points of new, given from the latest date to the earliest one.
+func newTimeSeries(latest time.Time, new ...int64) store.TimeSeries {
+	ts := store.TimeSeries{}
+	for i, n := range new {
+		ts.DataPoints = append(ts.DataPoints, store.TimeSeriesDataPoint{New: n, Date: latest.AddDate(0, 0, -i)})
+	}
+	return ts
+}
+
+// receiver is a webhook target that fails the first failures requests.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.bodies = append(rc.bodies, body)
+	rc.headers = append(rc.headers, r.Header)
+
+	if len(rc.bodies) <= rc.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func TestEvaluateAboveRule(t *testing.T) {
+	latest := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	rc := &receiver{failures: 1}
+	target := httptest.NewServer(rc)
+	defer target.Close()
+
+	st := &storetest.StubStore{
+		AggTimeSeries: newTimeSeries(latest, 120, 80),
+		Subscriptions: []store.Subscription{
+			{ID: 1, URL: target.URL, Secret: "s3cret", CountrySlug: "italy", Metric: store.Confirmed, Rule: store.AboveRule, Threshold: 100},
+			{ID: 2, URL: target.URL, Secret: "s3cret", CountrySlug: "italy", Metric: store.Confirmed, Rule: store.AboveRule, Threshold: 500},
+			{ID: 3, URL: target.URL, Secret: "s3cret", CountrySlug: "france", Metric: store.Confirmed, Rule: store.AboveRule, Threshold: 0},
+			{ID: 4, URL: target.URL, Secret: "s3cret", CountrySlug: "italy", Metric: store.Recoveries, Rule: store.AboveRule, Threshold: 0},
+		},
+	}
+
+	notifier := webhooks.NewNotifier(st)
+	notifier.AllowPrivateTargets = true
+	notifier.Backoff = time.Millisecond
+
+	report := &store.IngestReport{
+		IngestRun: store.IngestRun{Series: store.ConfirmedAndDeathsRun},
+		Countries: []string{"italy"},
+	}
+
+	if err := notifier.Evaluate(report); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only subscription 1 holds; its first attempt fails and the second one succeeds.
+	if got, want := len(rc.bodies), 2; got != want {
+		t.Fatalf("received %d requests; want %d", got, want)
+	}
+
+	alert := webhooks.Alert{}
+	if err := json.Unmarshal(rc.bodies[1], &alert); err != nil {
+		t.Fatal(err)
+	}
+
+	if alert.SubscriptionID != 1 || alert.Value != 120 || !alert.Date.Equal(latest) {
+		t.Errorf("received alert %+v; want subscription 1 with value 120 on %v", alert, latest)
+	}
+
+	if got, want := rc.headers[1].Get(webhooks.SignatureHeader), webhooks.Sign("s3cret", rc.bodies[1]); got != want {
+		t.Errorf("%s = %q; want %q", webhooks.SignatureHeader, got, want)
+	}
+
+	deliveries, err := st.GetDeliveries(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(deliveries), 2; got != want {
+		t.Fatalf("len(GetDeliveries(1)) = %d; want %d", got, want)
+	}
+	if !deliveries[0].Succeeded() || deliveries[0].Attempt != 2 {
+		t.Errorf("latest delivery = %+v; want a successful second attempt", deliveries[0])
+	}
+	if deliveries[1].Succeeded() || *deliveries[1].StatusCode != http.StatusInternalServerError {
+		t.Errorf("first delivery = %+v; want a failed attempt", deliveries[1])
+	}
+
+	// The alert of the date was delivered, so it is not sent again.
+	if err := notifier.Evaluate(report); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(rc.bodies), 2; got != want {
+		t.Errorf("received %d requests after evaluating again; want %d", got, want)
+	}
+}
+
+func TestEvaluateGrowthRule(t *testing.T) {
+	latest := time.Date(2020, 3, 14, 0, 0, 0, 0, time.UTC)
+	rc := &receiver{}
+	target := httptest.NewServer(rc)
+	defer target.Close()
+
+	st := &storetest.StubStore{
+		// 70 new cases over the last 7 days against 50 over the 7 days before: 40% growth.
+		AggTimeSeries: newTimeSeries(latest, 10, 10, 10, 10, 10, 10, 10, 5, 5, 10, 10, 10, 5, 5),
+		Subscriptions: []store.Subscription{
+			{ID: 1, URL: target.URL, CountrySlug: "italy", Metric: store.Deaths, Rule: store.GrowthRule, Threshold: 50},
+			{ID: 2, URL: target.URL, CountrySlug: "italy", Metric: store.Deaths, Rule: store.GrowthRule, Threshold: 25},
+		},
+	}
+
+	notifier := webhooks.NewNotifier(st)
+	notifier.AllowPrivateTargets = true
+
+	err := notifier.Evaluate(&store.IngestReport{
+		IngestRun: store.IngestRun{Series: store.ConfirmedAndDeathsRun},
+		Countries: []string{"italy"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(rc.bodies), 1; got != want {
+		t.Fatalf("received %d requests; want %d", got, want)
+	}
+
+	alert := webhooks.Alert{}
+	if err := json.Unmarshal(rc.bodies[0], &alert); err != nil {
+		t.Fatal(err)
+	}
+
+	if alert.SubscriptionID != 2 || alert.Value != 40 {
+		t.Errorf("received alert %+v; want subscription 2 with value 40", alert)
+	}
+}
+
+func TestListenDoesNotWaitOnDeliveries(t *testing.T) {
+	latest := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	release := make(chan struct{})
+	received := make(chan int64, 2)
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alert := webhooks.Alert{}
+		json.NewDecoder(r.Body).Decode(&alert)
+		received <- alert.SubscriptionID
+
+		// The delivery to italy hangs until the test is over.
+		if alert.CountrySlug == "italy" {
+			<-release
+		}
+	}))
+	defer target.Close()
+	defer close(release)
+
+	st := &storetest.StubStore{
+		AggTimeSeries: newTimeSeries(latest, 120),
+		Subscriptions: []store.Subscription{
+			{ID: 1, URL: target.URL, CountrySlug: "italy", Metric: store.Confirmed, Rule: store.AboveRule, Threshold: 100},
+			{ID: 2, URL: target.URL, CountrySlug: "france", Metric: store.Confirmed, Rule: store.AboveRule, Threshold: 100},
+		},
+	}
+
+	bus := events.NewBus(10)
+	defer bus.Close()
+
+	notifier := webhooks.NewNotifier(st)
+	notifier.AllowPrivateTargets = true
+	notifier.Listen(bus)
+
+	for _, countrySlug := range []string{"italy", "france"} {
+		bus.Publish(events.IngestCompleted, &store.IngestReport{
+			IngestRun: store.IngestRun{Series: store.ConfirmedAndDeathsRun},
+			Countries: []string{countrySlug},
+		})
+	}
+
+	// Both alerts are received while the first delivery still hangs.
+	ids := map[int64]bool{}
+	for len(ids) < 2 {
+		select {
+		case id := <-received:
+			ids[id] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received alerts of subscriptions %v; want 1 and 2", ids)
+		}
+	}
+}
+
+func TestEvaluateRefusesPrivateTargets(t *testing.T) {
+	latest := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	rc := &receiver{}
+	target := httptest.NewServer(rc)
+	defer target.Close()
+
+	st := &storetest.StubStore{
+		AggTimeSeries: newTimeSeries(latest, 120),
+		Subscriptions: []store.Subscription{
+			{ID: 1, URL: target.URL, CountrySlug: "italy", Metric: store.Confirmed, Rule: store.AboveRule, Threshold: 100},
+		},
+	}
+
+	notifier := webhooks.NewNotifier(st)
+	notifier.Attempts = 1
+
+	err := notifier.Evaluate(&store.IngestReport{
+		IngestRun: store.IngestRun{Series: store.ConfirmedAndDeathsRun},
+		Countries: []string{"italy"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(rc.bodies); got != 0 {
+		t.Errorf("received %d requests; want none", got)
+	}
+
+	deliveries, err := st.GetDeliveries(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deliveries) != 1 || !strings.Contains(deliveries[0].Error, webhooks.ErrPrivateTarget.Error()) {
+		t.Errorf("GetDeliveries(1) = %+v; want a delivery failed with %q", deliveries, webhooks.ErrPrivateTarget)
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	tests := map[string]error{
+		"93.184.216.34":   nil,
+		"2606:4700::1":    nil,
+		"127.0.0.1":       webhooks.ErrPrivateTarget,
+		"localhost":       webhooks.ErrPrivateTarget,
+		"10.0.0.8":        webhooks.ErrPrivateTarget,
+		"192.168.1.1":     webhooks.ErrPrivateTarget,
+		"169.254.169.254": webhooks.ErrPrivateTarget,
+		"0.0.0.0":         webhooks.ErrPrivateTarget,
+		"::1":             webhooks.ErrPrivateTarget,
+		"fe80::1":         webhooks.ErrPrivateTarget,
+	}
+
+	for host, want := range tests {
+		if got := webhooks.CheckTarget(context.Background(), host); got != want {
+			t.Errorf("CheckTarget(%q) = %v; want %v", host, got, want)
+		}
+	}
+}
@@ -4,12 +4,18 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
+	"github.com/jaaanko/covid-19-api/internal/events"
 	"github.com/jaaanko/covid-19-api/internal/server"
 	"github.com/jaaanko/covid-19-api/internal/store"
+	"github.com/jaaanko/covid-19-api/internal/webhooks"
 )
 
+// eventHistory is the number of events kept for clients reconnecting to /events.
+const eventHistory = 100
+
 func main() {
 	initialTicker := time.NewTicker(1)
 	interval := 12 * time.Hour
@@ -17,6 +23,8 @@ func main() {
 	ticker := time.NewTicker(interval)
 	done := make(chan (bool))
 
+	dbDriver := os.Getenv("COVID19_DB_DRIVER")
+	dbPath := os.Getenv("COVID19_DB_PATH")
 	dbUser := os.Getenv("COVID19_DB_USER")
 	dbPass := os.Getenv("COVID19_DB_PASS")
 	dbHost := os.Getenv("COVID19_DB_HOST")
@@ -25,37 +33,112 @@ func main() {
 
 	var st store.Service
 	err := retry(5, 5*time.Second, func() (err error) {
-		st, err = store.NewMySql(fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", dbUser, dbPass, dbHost, dbPort, dbName))
+		switch dbDriver {
+		case "sqlite":
+			st, err = store.NewSqlite(dbPath)
+		case "", "mysql":
+			st, err = store.NewMySql(fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", dbUser, dbPass, dbHost, dbPort, dbName))
+		default:
+			err = fmt.Errorf("unknown database driver %q", dbDriver)
+		}
 		return
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	db, err := st.GetDbInstance()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(st, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if os.Getenv("COVID19_DB_AUTO_MIGRATE") != "false" {
+		if err := migrate(st, []string{"up"}); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := store.SeedReferenceData(st); err != nil {
+		log.Fatal(err)
+	}
+
+	dataCollector, err := store.NewJhuCsseDataCollector(st, store.NewSource(os.Getenv("COVID19_DATA_SOURCE")))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	dataCollector, err := store.NewJhuCsseDataCollector(db)
+	cacheOptions, err := cacheOptionsFromEnv()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// The server reads through the cache, which is invalidated before the ingest is announced
+	// so that listeners read the new data.
+	served := st
+	if cacheOptions.TTL > 0 {
+		cached := store.NewCachedService(st, cacheOptions)
+		dataCollector.OnIngest(func(report *store.IngestReport) {
+			cached.Invalidate()
+		})
+		served = cached
+	}
+
+	bus := events.NewBus(eventHistory)
+	dataCollector.OnIngest(func(report *store.IngestReport) {
+		bus.Publish(events.IngestCompleted, report)
+	})
+
+	// The server and the notifier listen before the first update, so that none of its events are missed.
+	s := server.New(served)
+	s.SetAPIKey(os.Getenv("COVID19_API_KEY"))
+	s.Listen(bus)
+	webhooks.NewNotifier(st).Listen(bus)
+
+	ingestUSCounties := os.Getenv("COVID19_INGEST_US_COUNTIES") != "false"
+
 	updateData := func() {
+		// The US counties are written to the same table as the global confirmed cases and deaths,
+		// so they are updated after them rather than alongside.
+		go func() {
+			report, err := dataCollector.UpdateConfirmedAndDeaths()
+			if err != nil {
+				log.Println("error updating confirmed and deaths:", err)
+			} else {
+				logUnmatched(report)
+			}
+
+			if !ingestUSCounties {
+				return
+			}
+
+			report, err = dataCollector.UpdateUSCounties()
+			if err != nil {
+				log.Println("error updating US counties:", err)
+				return
+			}
+			logUnmatched(report)
+		}()
+
 		go func() {
-			err := dataCollector.UpdateConfirmedAndDeaths()
+			report, err := dataCollector.UpdateRecoveries()
 			if err != nil {
-				log.Fatal(err)
+				log.Println("error updating recoveries:", err)
+				return
 			}
+			logUnmatched(report)
 		}()
 
 		go func() {
-			err := dataCollector.UpdateRecoveries()
+			report, err := dataCollector.UpdateDailyReports()
 			if err != nil {
-				log.Fatal(err)
+				log.Println("error updating daily reports:", err)
+				return
 			}
+			logUnmatched(report)
 		}()
+
 	}
 
 	go func() {
@@ -72,7 +155,6 @@ func main() {
 		}
 	}()
 
-	s := server.New(st)
 	serverPort := os.Getenv("COVID19_SERVER_PORT")
 
 	err = s.Run(fmt.Sprintf(":%s", serverPort))
@@ -82,6 +164,78 @@ func main() {
 	}
 }
 
+// cacheOptionsFromEnv reads COVID19_CACHE_TTL, a duration that disables the cache when 0, and
+// COVID19_CACHE_SIZE, the number of results it keeps.
+func cacheOptionsFromEnv() (store.CacheOptions, error) {
+	opts := store.CacheOptions{TTL: time.Hour, MaxEntries: 1000}
+
+	if ttl := os.Getenv("COVID19_CACHE_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d < 0 {
+			return opts, fmt.Errorf("invalid COVID19_CACHE_TTL %q, expected a duration such as 1h", ttl)
+		}
+		opts.TTL = d
+	}
+
+	if size := os.Getenv("COVID19_CACHE_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 1 {
+			return opts, fmt.Errorf("invalid COVID19_CACHE_SIZE %q, expected a positive number", size)
+		}
+		opts.MaxEntries = n
+	}
+
+	return opts, nil
+}
+
+// migrate runs the migrate subcommand: migrate [up | down [steps] | status].
+func migrate(st store.Service, args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := store.MigrateUp(st)
+		for _, m := range applied {
+			log.Printf("Applied migration %d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+
+		reverted, err := store.MigrateDown(st, steps)
+		for _, m := range reverted {
+			log.Printf("Reverted migration %d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		status, err := store.GetMigrationStatus(st)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
+}
+
 func retry(attempts int, sleep time.Duration, f func() error) (err error) {
 	for i := 0; ; i++ {
 		err = f()
@@ -99,3 +253,13 @@ func retry(attempts int, sleep time.Duration, f func() error) (err error) {
 	}
 	return err
 }
+
+func logUnmatched(report *store.IngestReport) {
+	for _, u := range report.Unmatched {
+		if u.County != "" {
+			log.Printf("skipped %q/%q/%q in %s: %s\n", u.County, u.Province, u.Country, u.Series, u.Reason)
+			continue
+		}
+		log.Printf("skipped %q/%q in %s: %s\n", u.Province, u.Country, u.Series, u.Reason)
+	}
+}